@@ -0,0 +1,611 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"runtime"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/alecthomas/chroma/styles"
+	"github.com/clark-ioe/md2nsx/nsx"
+	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
+)
+
+// convertFlags holds the flags shared by every command that converts markdown
+type convertFlags struct {
+	notebookName string
+	maxNotes     int
+	maxSize      string
+	workers      int
+	timestamp    string
+	cacheDir     string
+	theme        string
+	disable      []string
+	tags         []string
+	tagRules     []nsx.TagRule
+	assetRoots   []string
+	include      []string
+	exclude      []string
+	recursive    bool
+	configPath   string
+	filters      []nsx.Filter
+	markdownCmds []string
+	htmlCmds     []string
+	headerPath   string
+	footerPath   string
+	output       string
+	force        bool
+	filesFrom    string
+	dryRun       bool
+	reportPath   string
+	strict       bool
+	timeout      time.Duration
+	upload       bool
+	dsm          dsmFlags
+}
+
+// register adds the conversion flags to a command's flag set
+func (f *convertFlags) register(flags *pflag.FlagSet) {
+	flags.StringVarP(&f.notebookName, "notebook", "n", nsx.DefaultNotebook, "notebook name")
+	flags.IntVar(&f.maxNotes, "max-notes", 0, "split output into NSX files of at most this many notes (0 = no limit)")
+	flags.StringVar(&f.maxSize, "max-size", "", "split output into NSX files of at most this size, e.g. 50MB")
+	flags.IntVarP(&f.workers, "jobs", "j", runtime.NumCPU(), "number of files to convert concurrently")
+	flags.StringVar(&f.timestamp, "timestamp", os.Getenv("SOURCE_DATE_EPOCH"), "fixed Unix timestamp for reproducible output (default: $SOURCE_DATE_EPOCH)")
+	flags.StringVar(&f.cacheDir, "cache-dir", "", "directory for the conversion cache (empty = no cache)")
+	flags.StringVar(&f.theme, "theme", "github", "syntax highlighting style for code blocks")
+	flags.StringSliceVar(&f.disable, "disable-extension", nil, "turn off a built-in markdown extension: "+strings.Join(nsx.BuiltinExtensions, ", ")+" (repeatable)")
+	flags.StringArrayVar(&f.markdownCmds, "filter", nil, "external command that transforms each note's markdown, passed as JSON on stdin; split on whitespace, without quoting (repeatable)")
+	flags.StringArrayVar(&f.htmlCmds, "html-filter", nil, "external command that transforms each note's rendered HTML, passed as JSON on stdin; split on whitespace, without quoting (repeatable)")
+	flags.StringVar(&f.headerPath, "header-template", "", "text/template file rendered at the top of every note")
+	flags.StringVar(&f.footerPath, "footer-template", "", "text/template file rendered at the bottom of every note")
+	flags.StringSliceVar(&f.tags, "tag", nil, "tag added to every note (repeatable)")
+	flags.StringSliceVar(&f.assetRoots, "asset-root", nil, "extra directory searched for attachments (repeatable)")
+	flags.StringSliceVar(&f.include, "include", nil, "only convert markdown files matching this pattern (repeatable)")
+	flags.StringSliceVar(&f.exclude, "exclude", nil, "skip markdown files and folders matching this pattern (repeatable)")
+	flags.BoolVarP(&f.recursive, "recursive", "r", false, "also convert markdown files in subfolders")
+	flags.StringVarP(&f.output, "output", "o", "", "output NSX file, or - for stdout (default: <markdown_folder>.nsx)")
+	flags.BoolVarP(&f.force, "force", "f", false, "overwrite existing output files")
+	flags.BoolVar(&f.dryRun, "dry-run", false, "resolve and render everything and print the plan, but write no NSX file")
+	flags.StringVar(&f.reportPath, "report", "", "write a JSON report of every source file, its note, status, warnings and attachments")
+	flags.BoolVar(&f.strict, "strict", false, "exit with an error if any markdown file failed to convert")
+	flags.DurationVar(&f.timeout, "timeout", 0, "give up on a conversion that takes longer than this, e.g. 5m (0 = no limit)")
+	flags.StringVar(&f.filesFrom, "files-from", "", "read a newline-separated list of markdown files from this file, or - for stdin")
+	flags.BoolVar(&f.upload, "upload", false, "upload the NSX files to a DSM for importing into Note Station (see \"md2nsx upload\")")
+	f.dsm.register(flags)
+	flags.StringVar(&f.configPath, "config", "", "config file (default: md2nsx.yaml, md2nsx.yml or md2nsx.toml in the markdown folder)")
+}
+
+// load applies the project config file, if any, to the flags that were not
+// given on the command line
+func (f *convertFlags) load(flagSet *pflag.FlagSet, mdFolder string) error {
+	configPath, err := findConfigFile(f.configPath, mdFolder)
+	if err != nil || configPath == "" {
+		return err
+	}
+
+	config, err := loadConfigFile(configPath)
+	if err != nil {
+		return err
+	}
+	config.apply(f, flagSet)
+
+	logger.Info("Using config file", "path", configPath)
+	return nil
+}
+
+// options validates the flags and turns them into converter options
+func (f *convertFlags) options() (nsx.Options, error) {
+	maxBytes, err := parseSize(f.maxSize)
+	if err != nil {
+		return nsx.Options{}, fmt.Errorf("invalid --max-size value '%s': %w", f.maxSize, err)
+	}
+	if f.maxNotes < 0 {
+		return nsx.Options{}, fmt.Errorf("--max-notes must not be negative")
+	}
+	if f.workers < 1 {
+		return nsx.Options{}, fmt.Errorf("--jobs must be at least 1")
+	}
+
+	var fixedTime time.Time
+	if f.timestamp != "" {
+		seconds, err := strconv.ParseInt(f.timestamp, 10, 64)
+		if err != nil {
+			return nsx.Options{}, fmt.Errorf("invalid timestamp '%s': %w", f.timestamp, err)
+		}
+		fixedTime = time.Unix(seconds, 0)
+	}
+
+	if _, ok := styles.Registry[f.theme]; !ok {
+		return nsx.Options{}, fmt.Errorf("unknown theme '%s'", f.theme)
+	}
+	for _, name := range f.disable {
+		if !slices.Contains(nsx.BuiltinExtensions, name) {
+			return nsx.Options{}, fmt.Errorf("unknown markdown extension '%s' (use %s)", name, strings.Join(nsx.BuiltinExtensions, ", "))
+		}
+	}
+
+	// Filter commands are split on whitespace; there is no shell quoting
+	filters := f.filters
+	for _, command := range f.markdownCmds {
+		filters = append(filters, nsx.Filter{Command: strings.Fields(command), Stage: nsx.FilterStageMarkdown})
+	}
+	for _, command := range f.htmlCmds {
+		filters = append(filters, nsx.Filter{Command: strings.Fields(command), Stage: nsx.FilterStageHTML})
+	}
+	for _, filter := range filters {
+		if len(filter.Command) == 0 {
+			return nsx.Options{}, fmt.Errorf("filter command must not be empty")
+		}
+	}
+
+	header, err := readTemplate(f.headerPath)
+	if err != nil {
+		return nsx.Options{}, err
+	}
+	footer, err := readTemplate(f.footerPath)
+	if err != nil {
+		return nsx.Options{}, err
+	}
+
+	return nsx.Options{
+		Notebook:          f.notebookName,
+		MaxNotesPerFile:   f.maxNotes,
+		MaxBytesPerFile:   maxBytes,
+		Workers:           f.workers,
+		Timestamp:         fixedTime,
+		CacheDir:          f.cacheDir,
+		Theme:             f.theme,
+		DisableExtensions: f.disable,
+		Filters:           filters,
+		Header:            header,
+		Footer:            footer,
+		Tags:              f.tags,
+		TagRules:          f.tagRules,
+		AssetRoots:        f.assetRoots,
+		Include:           f.include,
+		Exclude:           f.exclude,
+		Recursive:         f.recursive,
+		Force:             f.force,
+		DryRun:            f.dryRun,
+		Strict:            f.strict,
+		Logger:            logger,
+	}, nil
+}
+
+// newRootCommand builds the md2nsx command tree. Running the root command
+// with a folder or files is kept as a shortcut for "md2nsx convert".
+func newRootCommand() *cobra.Command {
+	flags := &convertFlags{}
+	var quiet, verbose bool
+	var logFormat string
+
+	root := &cobra.Command{
+		Use:   "md2nsx [flags] <markdown_folder | files...>",
+		Short: "Convert Markdown files to Synology Note Station (NSX) format",
+		Example: `  md2nsx convert ./markdown-files
+  md2nsx convert ./markdown-files -n "My Notes"
+  md2nsx convert ./markdown-files --max-size 50MB
+  md2nsx convert ./markdown-files --dry-run
+  md2nsx convert ./markdown-files -o - | ssh nas 'cat > notes.nsx'
+  md2nsx convert docs-1.2.tar.gz -r -n "Docs 1.2"
+  md2nsx convert intro.md 'docs/*.md' -n "Handbook"
+  git ls-files '*.md' | md2nsx convert --files-from - -n "Repo Docs"
+  md2nsx watch ./markdown-files -n "My Notes"
+  md2nsx inspect ./markdown-files.nsx
+  md2nsx serve --listen :8080
+  md2nsx convert ./markdown-files --upload --dsm-url https://nas.local:5001 --dsm-user me`,
+		Args:          cobra.ArbitraryArgs,
+		SilenceUsage:  true,
+		SilenceErrors: true,
+		PersistentPreRunE: func(cmd *cobra.Command, args []string) error {
+			return setupLogging(cmd.ErrOrStderr(), quiet, verbose, logFormat)
+		},
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if len(args) == 0 && flags.filesFrom == "" {
+				return cmd.Help()
+			}
+			return runConvert(cmd, flags, args)
+		},
+	}
+	flags.register(root.Flags())
+	root.PersistentFlags().BoolVarP(&quiet, "quiet", "q", false, "only log warnings and errors")
+	root.PersistentFlags().BoolVarP(&verbose, "verbose", "v", false, "also log every file and attachment processed")
+	root.PersistentFlags().StringVar(&logFormat, "log-format", "text", "log format: text or json")
+
+	root.AddCommand(
+		newConvertCommand(),
+		newWatchCommand(),
+		newInspectCommand(),
+		newValidateCommand(),
+		newExportCommand(),
+		newServeCommand(),
+		newUploadCommand(),
+	)
+
+	return root
+}
+
+// newConvertCommand builds "md2nsx convert"
+func newConvertCommand() *cobra.Command {
+	flags := &convertFlags{}
+
+	cmd := &cobra.Command{
+		Use:   "convert [flags] <markdown_folder | files...>",
+		Short: "Convert a folder or a list of markdown files into an NSX file",
+		Long: `Convert a folder or a list of markdown files into an NSX file.
+
+A single folder argument converts every markdown file in that folder. A
+single .zip, .tar.gz, .tgz or .tar argument is converted like a folder
+without extracting it; an archive with one top-level folder is converted
+from that folder, and the config file is looked up next to the archive. Any
+other combination of files, glob patterns and folders (plus the list read
+with --files-from) produces one notebook containing exactly those notes;
+folders are searched like a single folder argument, with --recursive, the
+include and exclude patterns and .nsxignore.`,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if len(args) == 0 && flags.filesFrom == "" {
+				return fmt.Errorf("no markdown folder or files given")
+			}
+			return runConvert(cmd, flags, args)
+		},
+	}
+	flags.register(cmd.Flags())
+
+	return cmd
+}
+
+// newWatchCommand builds "md2nsx watch"
+func newWatchCommand() *cobra.Command {
+	flags := &convertFlags{}
+	var debounce time.Duration
+
+	cmd := &cobra.Command{
+		Use:   "watch [flags] <markdown_folder>",
+		Short: "Rebuild the NSX file whenever the markdown or its attachments change",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if flags.output == "-" {
+				return fmt.Errorf("watch mode cannot write to stdout")
+			}
+			if flags.dryRun {
+				return fmt.Errorf("watch mode does not support --dry-run")
+			}
+			if flags.upload {
+				return fmt.Errorf("watch mode does not support --upload")
+			}
+			if err := checkFolder(args[0]); err != nil {
+				return err
+			}
+			options, err := converterOptions(cmd, flags, args[0])
+			if err != nil {
+				return err
+			}
+			// Watch mode always caches, in memory if no cache directory was given
+			options.MemoryCache = true
+			return watchFolder(cmd.Context(), nsx.NewConverter(options), args[0], flags, debounce)
+		},
+	}
+	flags.register(cmd.Flags())
+	cmd.Flags().DurationVar(&debounce, "debounce", 500*time.Millisecond, "delay after the last change before rebuilding")
+
+	return cmd
+}
+
+// runConvert converts a single folder or archive, or an explicit list of files
+func runConvert(cmd *cobra.Command, flags *convertFlags, args []string) error {
+	var sources []string
+	var configDir, done string
+	var archive *nsx.ArchiveFS
+
+	// A lone folder argument keeps the folder conversion behaviour, and a lone
+	// archive is converted like the folder inside it
+	single := len(args) == 1 && flags.filesFrom == ""
+	folder := single && !isFile(args[0]) && !hasGlobMeta(args[0])
+	switch {
+	case single && isFile(args[0]) && nsx.IsArchive(args[0]):
+		var err error
+		archive, err = nsx.OpenArchive(args[0])
+		if err != nil {
+			return err
+		}
+		defer archive.Close()
+		sources = []string{archive.Root()}
+		configDir = filepath.Dir(args[0])
+		done = fmt.Sprintf("Successfully converted markdown files in '%s' to NSX format", args[0])
+	case folder:
+		if err := checkFolder(args[0]); err != nil {
+			return err
+		}
+		sources = args
+		configDir = args[0]
+		done = fmt.Sprintf("Successfully converted markdown files in '%s' to NSX format", args[0])
+	default:
+		var err error
+		sources, err = collectFiles(args, flags.filesFrom, cmd.InOrStdin())
+		if err != nil {
+			return err
+		}
+		if len(sources) == 0 {
+			return fmt.Errorf("no markdown files found")
+		}
+		configDir = sourcesDir(sources)
+	}
+
+	options, err := converterOptions(cmd, flags, configDir)
+	if err != nil {
+		return err
+	}
+	if flags.upload {
+		if flags.output == "-" {
+			return fmt.Errorf("--upload cannot be combined with writing to stdout")
+		}
+		if err := flags.dsm.check(); err != nil {
+			return err
+		}
+	}
+	if archive != nil {
+		options.FS = archive
+	}
+	display := newProgressDisplay()
+	if display != nil {
+		options.Progress = display.Update
+	}
+	converter := nsx.NewConverter(options)
+
+	// The notebook name may come from the config file, so the default output
+	// is only known now
+	outputPath := flags.output
+	switch {
+	case outputPath != "":
+	case archive != nil:
+		outputPath = nsx.TrimArchiveExtension(args[0]) + ".nsx"
+	case folder:
+		outputPath = defaultOutputPath(args[0])
+	case len(sources) == 1:
+		outputPath = strings.TrimSuffix(sources[0], filepath.Ext(sources[0])) + ".nsx"
+	default:
+		outputPath = safeFilename(options.Notebook) + ".nsx"
+	}
+
+	ctx, cancel := flags.context(cmd.Context())
+	defer cancel()
+
+	var report *nsx.Report
+	if outputPath == "-" {
+		report, err = converter.Convert(ctx, sources, cmd.OutOrStdout())
+		if report != nil {
+			report.Outputs = []string{"stdout"}
+		}
+	} else {
+		report, err = converter.ConvertToFiles(ctx, sources, outputPath)
+	}
+	display.Finish()
+
+	if reportErr := writeReport(flags, report); reportErr != nil {
+		if err == nil {
+			return reportErr
+		}
+		logger.Warn("Could not write report", "error", reportErr)
+	}
+	if err != nil {
+		return conversionError(err)
+	}
+
+	if flags.dryRun {
+		report.WritePlan(cmd.OutOrStdout())
+		return nil
+	}
+
+	if done == "" {
+		done = fmt.Sprintf("Successfully converted %d markdown files to NSX format", report.Count(nsx.StatusConverted)+report.Count(nsx.StatusCached))
+	}
+	logger.Info(done)
+	if flags.upload {
+		return uploadFiles(cmd.Context(), &flags.dsm, report.Outputs)
+	}
+	return nil
+}
+
+// readTemplate reads a header or footer template file, if one was given
+func readTemplate(templatePath string) (string, error) {
+	if templatePath == "" {
+		return "", nil
+	}
+	data, err := os.ReadFile(templatePath)
+	if err != nil {
+		return "", fmt.Errorf("failed to read template: %w", err)
+	}
+	return string(data), nil
+}
+
+// context returns the context for a single conversion, limited by --timeout
+func (f *convertFlags) context(parent context.Context) (context.Context, context.CancelFunc) {
+	if f.timeout > 0 {
+		return context.WithTimeout(parent, f.timeout)
+	}
+	return context.WithCancel(parent)
+}
+
+// conversionError adds command line hints to an error returned by the
+// converter
+func conversionError(err error) error {
+	switch {
+	case errors.Is(err, nsx.ErrOutputExists):
+		return fmt.Errorf("conversion failed: %w (use --force to overwrite)", err)
+	case errors.Is(err, context.DeadlineExceeded):
+		return fmt.Errorf("conversion failed: %w (raise --timeout to allow more time)", err)
+	case errors.Is(err, context.Canceled):
+		return fmt.Errorf("conversion interrupted: %w", err)
+	}
+	return fmt.Errorf("conversion failed: %w", err)
+}
+
+// writeReport saves the report when --report is given. Partial reports of a
+// failed run are written too.
+func writeReport(flags *convertFlags, report *nsx.Report) error {
+	if flags.reportPath == "" || report == nil {
+		return nil
+	}
+	if err := report.WriteFile(flags.reportPath); err != nil {
+		return err
+	}
+	logger.Info("Wrote report", "path", flags.reportPath)
+	return nil
+}
+
+// defaultOutputPath names the NSX file after the markdown folder and places
+// it next to the folder, so "notes/" becomes "notes.nsx" and "." becomes
+// "../<current directory name>.nsx"
+func defaultOutputPath(mdFolder string) string {
+	cleanFolder := filepath.Clean(mdFolder)
+	switch filepath.Base(cleanFolder) {
+	case ".", "..", string(filepath.Separator):
+		if absFolder, err := filepath.Abs(cleanFolder); err == nil {
+			cleanFolder = absFolder
+		}
+	}
+	return cleanFolder + ".nsx"
+}
+
+// checkFolder verifies that the markdown folder exists
+func checkFolder(markdownFolder string) error {
+	info, err := os.Stat(markdownFolder)
+	if os.IsNotExist(err) {
+		return fmt.Errorf("markdown folder '%s' does not exist", markdownFolder)
+	}
+	if err != nil {
+		return err
+	}
+	if !info.IsDir() {
+		return fmt.Errorf("'%s' is not a folder", markdownFolder)
+	}
+	return nil
+}
+
+// converterOptions applies the project config file found in configDir (or
+// given with --config) and returns the converter options
+func converterOptions(cmd *cobra.Command, flags *convertFlags, configDir string) (nsx.Options, error) {
+	if err := flags.load(cmd.Flags(), configDir); err != nil {
+		return nsx.Options{}, err
+	}
+	return flags.options()
+}
+
+// collectFiles expands the command line arguments and the optional file list
+// into conversion sources. Files and folders are passed on as they are, so
+// folders go through the same discovery as a lone folder argument, with
+// --recursive, the include and exclude patterns and .nsxignore. Glob
+// patterns, expanded for shells that do not do it, contribute the markdown
+// files they match. Duplicates are dropped while keeping the order in which
+// the sources were given.
+func collectFiles(args []string, filesFrom string, stdin io.Reader) ([]string, error) {
+	inputs := append([]string{}, args...)
+
+	if filesFrom != "" {
+		listed, err := readFileList(filesFrom, stdin)
+		if err != nil {
+			return nil, err
+		}
+		inputs = append(inputs, listed...)
+	}
+
+	sources := make([]string, 0)
+	seen := make(map[string]bool)
+	add := func(source string) {
+		key := filepath.Clean(source)
+		if !seen[key] {
+			seen[key] = true
+			sources = append(sources, source)
+		}
+	}
+
+	for _, input := range inputs {
+		_, err := os.Stat(input)
+		switch {
+		case err == nil:
+			add(input)
+		case hasGlobMeta(input):
+			matches, err := filepath.Glob(input)
+			if err != nil {
+				return nil, fmt.Errorf("invalid pattern '%s': %w", input, err)
+			}
+			// Patterns only contribute markdown files, so "notes/*" does
+			// not turn images into notes
+			found := 0
+			for _, match := range matches {
+				if strings.HasSuffix(match, ".md") && isFile(match) {
+					add(match)
+					found++
+				}
+			}
+			if found == 0 {
+				return nil, fmt.Errorf("no markdown files match '%s'", input)
+			}
+		default:
+			return nil, fmt.Errorf("markdown file '%s' does not exist", input)
+		}
+	}
+
+	return sources, nil
+}
+
+// sourcesDir returns the closest folder containing all sources, counting a
+// folder source as its own folder rather than its parent's
+func sourcesDir(sources []string) string {
+	paths := make([]string, len(sources))
+	for i, source := range sources {
+		paths[i] = source
+		if !isFile(source) {
+			paths[i] = filepath.Join(source, "file")
+		}
+	}
+	return nsx.CommonDir(paths)
+}
+
+// readFileList reads a newline-separated list of files from a file or, for
+// "-", from stdin. Blank lines and lines starting with "#" are ignored.
+func readFileList(source string, stdin io.Reader) ([]string, error) {
+	reader := stdin
+	if source != "-" {
+		file, err := os.Open(source)
+		if err != nil {
+			return nil, fmt.Errorf("failed to open file list: %w", err)
+		}
+		defer file.Close()
+		reader = file
+	}
+
+	files := make([]string, 0)
+	scanner := bufio.NewScanner(reader)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		files = append(files, line)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read file list: %w", err)
+	}
+	return files, nil
+}
+
+// isFile reports whether path exists and is not a directory
+func isFile(path string) bool {
+	info, err := os.Stat(path)
+	return err == nil && !info.IsDir()
+}
+
+// hasGlobMeta reports whether path contains glob pattern characters
+func hasGlobMeta(path string) bool {
+	return strings.ContainsAny(path, "*?[")
+}
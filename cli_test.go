@@ -0,0 +1,46 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestCollectFiles(t *testing.T) {
+	dir := t.TempDir()
+	for _, name := range []string{"tree/a.md", "tree/sub/b.md", "tree/image.png", "x.md"} {
+		path := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte("# Note\n"), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	t.Chdir(dir)
+
+	// Folders are passed on for discovery rather than expanded here
+	sources, err := collectFiles([]string{"tree", "x.md", "tree/*", "./x.md"}, "-", strings.NewReader("tree/\n# comment\ntree/a.md\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"tree", "x.md", filepath.Join("tree", "a.md")}
+	if !reflect.DeepEqual(sources, want) {
+		t.Errorf("collectFiles returned %q, want %q", sources, want)
+	}
+	if got := sourcesDir(sources); got != "." {
+		t.Errorf("sourcesDir(%q) = %q, want .", sources, got)
+	}
+	if got := sourcesDir([]string{"tree", "tree/a.md"}); got != "tree" {
+		t.Errorf("sourcesDir of a folder and its file = %q, want tree", got)
+	}
+
+	if _, err := collectFiles([]string{"tree/*.txt"}, "", nil); err == nil {
+		t.Errorf("collectFiles accepted a pattern without markdown matches")
+	}
+	if _, err := collectFiles([]string{"missing.md"}, "", nil); err == nil {
+		t.Errorf("collectFiles accepted a missing file")
+	}
+}
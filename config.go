@@ -0,0 +1,232 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/BurntSushi/toml"
+	"github.com/clark-ioe/md2nsx/nsx"
+	"github.com/spf13/pflag"
+	"gopkg.in/yaml.v3"
+)
+
+// configFileNames are looked up, in order, in the markdown folder when no
+// --config flag is given
+var configFileNames = []string{"md2nsx.yaml", "md2nsx.yml", "md2nsx.toml"}
+
+// fileConfig is the content of a project config file. Every field is
+// optional; unset fields keep the command line defaults.
+type fileConfig struct {
+	Notebook   string         `yaml:"notebook" toml:"notebook"`
+	Theme      string         `yaml:"theme" toml:"theme"`
+	Disable    []string       `yaml:"disable_extensions" toml:"disable_extensions"`
+	Tags       []string       `yaml:"tags" toml:"tags"`
+	TagRules   []nsx.TagRule  `yaml:"tag_rules" toml:"tag_rules"`
+	AssetRoots []string       `yaml:"asset_roots" toml:"asset_roots"`
+	Include    []string       `yaml:"include" toml:"include"`
+	Exclude    []string       `yaml:"exclude" toml:"exclude"`
+	Recursive  bool           `yaml:"recursive" toml:"recursive"`
+	MaxNotes   int            `yaml:"max_notes" toml:"max_notes"`
+	MaxSize    string         `yaml:"max_size" toml:"max_size"`
+	Jobs       int            `yaml:"jobs" toml:"jobs"`
+	Timestamp  string         `yaml:"timestamp" toml:"timestamp"`
+	CacheDir   string         `yaml:"cache_dir" toml:"cache_dir"`
+	Filters    []filterConfig `yaml:"filters" toml:"filters"`
+	Header     string         `yaml:"header_template" toml:"header_template"`
+	Footer     string         `yaml:"footer_template" toml:"footer_template"`
+	DSM        dsmConfig      `yaml:"dsm" toml:"dsm"`
+
+	// dir is the directory of the config file
+	dir string
+}
+
+// filterConfig is an external filter in the config file. Its command is
+// split on whitespace, without quoting, and runs in the config file's
+// directory.
+type filterConfig struct {
+	Command string `yaml:"command" toml:"command"`
+	Stage   string `yaml:"stage" toml:"stage"`
+}
+
+// dsmConfig is the DSM that --upload sends NSX files to. Prefer
+// $MD2NSX_DSM_PASSWORD to a password in a file that may be committed.
+type dsmConfig struct {
+	URL      string `yaml:"url" toml:"url"`
+	User     string `yaml:"user" toml:"user"`
+	Password string `yaml:"password" toml:"password"`
+	Folder   string `yaml:"folder" toml:"folder"`
+	Insecure bool   `yaml:"insecure" toml:"insecure"`
+}
+
+// findConfigFile returns the config file to use: the explicit path if one was
+// given, otherwise the first config file found in the markdown folder, or ""
+func findConfigFile(explicit, mdFolder string) (string, error) {
+	if explicit != "" {
+		if _, err := os.Stat(explicit); err != nil {
+			return "", fmt.Errorf("config file '%s' not found", explicit)
+		}
+		return explicit, nil
+	}
+
+	for _, name := range configFileNames {
+		candidate := filepath.Join(mdFolder, name)
+		if info, err := os.Stat(candidate); err == nil && !info.IsDir() {
+			return candidate, nil
+		}
+	}
+	return "", nil
+}
+
+// loadConfigFile parses a YAML or TOML config file, chosen by extension.
+// Relative paths in the file are resolved against the file's directory.
+func loadConfigFile(configPath string) (*fileConfig, error) {
+	data, err := os.ReadFile(configPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read config file: %w", err)
+	}
+
+	config := &fileConfig{}
+	switch strings.ToLower(filepath.Ext(configPath)) {
+	case ".toml":
+		meta, err := toml.Decode(string(data), config)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse %s: %w", configPath, err)
+		}
+		// Reject unknown keys like the YAML decoder does, so typos are not
+		// silently ignored
+		if undecoded := meta.Undecoded(); len(undecoded) > 0 {
+			keys := make([]string, len(undecoded))
+			for i, key := range undecoded {
+				keys[i] = "'" + key.String() + "'"
+			}
+			return nil, fmt.Errorf("failed to parse %s: unknown keys %s", configPath, strings.Join(keys, ", "))
+		}
+	case ".yaml", ".yml":
+		decoder := yaml.NewDecoder(bytes.NewReader(data))
+		decoder.KnownFields(true)
+		if err := decoder.Decode(config); err != nil && !errors.Is(err, io.EOF) {
+			return nil, fmt.Errorf("failed to parse %s: %w", configPath, err)
+		}
+	default:
+		return nil, fmt.Errorf("unsupported config file format: %s (use .yaml, .yml or .toml)", configPath)
+	}
+
+	baseDir := filepath.Dir(configPath)
+	config.dir = baseDir
+	for i, root := range config.AssetRoots {
+		config.AssetRoots[i] = resolveRelative(baseDir, root)
+	}
+	if config.CacheDir != "" {
+		config.CacheDir = resolveRelative(baseDir, config.CacheDir)
+	}
+	if config.Header != "" {
+		config.Header = resolveRelative(baseDir, config.Header)
+	}
+	if config.Footer != "" {
+		config.Footer = resolveRelative(baseDir, config.Footer)
+	}
+
+	return config, nil
+}
+
+// resolveRelative resolves p against baseDir unless it is absolute
+func resolveRelative(baseDir, p string) string {
+	if filepath.IsAbs(p) {
+		return p
+	}
+	return filepath.Join(baseDir, p)
+}
+
+// apply copies the config file settings into flags that were not set on the
+// command line, so explicit flags always take precedence over the file
+func (config *fileConfig) apply(f *convertFlags, flagSet *pflag.FlagSet) {
+	unset := func(name string) bool {
+		return !flagSet.Changed(name)
+	}
+
+	if config.Notebook != "" && unset("notebook") {
+		f.notebookName = config.Notebook
+	}
+	if config.Theme != "" && unset("theme") {
+		f.theme = config.Theme
+	}
+	if len(config.Disable) > 0 && unset("disable-extension") {
+		f.disable = config.Disable
+	}
+	if len(config.Tags) > 0 && unset("tag") {
+		f.tags = config.Tags
+	}
+	if len(config.AssetRoots) > 0 && unset("asset-root") {
+		f.assetRoots = config.AssetRoots
+	}
+	if len(config.Include) > 0 && unset("include") {
+		f.include = config.Include
+	}
+	if len(config.Exclude) > 0 && unset("exclude") {
+		f.exclude = config.Exclude
+	}
+	if config.Recursive && unset("recursive") {
+		f.recursive = true
+	}
+	if config.MaxNotes != 0 && unset("max-notes") {
+		f.maxNotes = config.MaxNotes
+	}
+	if config.MaxSize != "" && unset("max-size") {
+		f.maxSize = config.MaxSize
+	}
+	if config.Jobs != 0 && unset("jobs") {
+		f.workers = config.Jobs
+	}
+	if config.Timestamp != "" && unset("timestamp") {
+		f.timestamp = config.Timestamp
+	}
+	if config.CacheDir != "" && unset("cache-dir") {
+		f.cacheDir = config.CacheDir
+	}
+	if config.Header != "" && unset("header-template") {
+		f.headerPath = config.Header
+	}
+	if config.Footer != "" && unset("footer-template") {
+		f.footerPath = config.Footer
+	}
+	if len(config.Filters) > 0 && unset("filter") && unset("html-filter") {
+		f.filters = make([]nsx.Filter, 0, len(config.Filters))
+		for _, filter := range config.Filters {
+			f.filters = append(f.filters, nsx.Filter{
+				Command: strings.Fields(filter.Command),
+				Stage:   filter.Stage,
+				Dir:     config.dir,
+			})
+		}
+	}
+
+	config.DSM.apply(&f.dsm, flagSet)
+
+	// Tag rules can only be set in the config file
+	f.tagRules = config.TagRules
+}
+
+// apply copies the DSM settings into flags that were not set on the command
+// line. A password from the environment takes precedence over the file.
+func (config dsmConfig) apply(d *dsmFlags, flagSet *pflag.FlagSet) {
+	if config.URL != "" && !flagSet.Changed("dsm-url") {
+		d.url = config.URL
+	}
+	if config.User != "" && !flagSet.Changed("dsm-user") {
+		d.user = config.User
+	}
+	if config.Password != "" && d.password == "" {
+		d.password = config.Password
+	}
+	if config.Folder != "" && !flagSet.Changed("dsm-folder") {
+		d.folder = config.Folder
+	}
+	if config.Insecure && !flagSet.Changed("dsm-insecure") {
+		d.insecure = true
+	}
+}
@@ -0,0 +1,38 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestLoadConfigFileUnknownKeys(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		wantErr string
+	}{
+		{"md2nsx.yaml", "notebook: Docs\ntag_rules:\n  - pattern: \"*.md\"\n    tags: [docs]\n", ""},
+		{"md2nsx.toml", "notebook = \"Docs\"\n[[tag_rules]]\npattern = \"*.md\"\ntags = [\"docs\"]\n", ""},
+		{"md2nsx.yaml", "notebok: Docs\n", "notebok"},
+		{"md2nsx.toml", "notebok = \"Docs\"\n", "notebok"},
+		{"md2nsx.toml", "[dsm]\npasword = \"x\"\n", "dsm.pasword"},
+		{"md2nsx.toml", "[[tag_rules]]\npattern = \"*.md\"\ntag = [\"docs\"]\n", "tag_rules.tag"},
+	}
+	for _, test := range tests {
+		configPath := filepath.Join(t.TempDir(), test.name)
+		if err := os.WriteFile(configPath, []byte(test.content), 0644); err != nil {
+			t.Fatal(err)
+		}
+		config, err := loadConfigFile(configPath)
+		switch {
+		case test.wantErr == "" && err != nil:
+			t.Errorf("%s %q: %v", test.name, test.content, err)
+		case test.wantErr == "" && config.Notebook != "Docs":
+			t.Errorf("%s %q: notebook %q, want Docs", test.name, test.content, config.Notebook)
+		case test.wantErr != "" && (err == nil || !strings.Contains(err.Error(), test.wantErr)):
+			t.Errorf("%s %q: got %v, want an error about %s", test.name, test.content, err, test.wantErr)
+		}
+	}
+}
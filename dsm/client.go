@@ -0,0 +1,312 @@
+// Package dsm is a minimal client for the Web API of Synology DSM, enough to
+// upload NSX files with File Station. Synology does not document a Web API
+// for Note Station's import, so uploaded files are imported from Note
+// Station's settings.
+//
+//	client := dsm.NewClient("https://nas.local:5001", nil)
+//	if err := client.Login(ctx, user, password, ""); err != nil {
+//		return err
+//	}
+//	defer client.Logout(ctx)
+//	remotePath, err := client.Upload(ctx, "/home/imports", "notes.nsx")
+package dsm
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// Web APIs used by the client
+const (
+	APIInfo   = "SYNO.API.Info"
+	APIAuth   = "SYNO.API.Auth"
+	APIUpload = "SYNO.FileStation.Upload"
+)
+
+// session is the DSM session name the client logs in to
+const session = "FileStation"
+
+// errorMessages describes the common error codes of the DSM Web API
+var errorMessages = map[int]string{
+	100:  "unknown error",
+	101:  "invalid parameter",
+	102:  "the requested API does not exist",
+	103:  "the requested method does not exist",
+	104:  "the requested version does not support the functionality",
+	105:  "the logged in session does not have permission",
+	106:  "session timeout",
+	107:  "session interrupted by duplicate login",
+	119:  "invalid session",
+	400:  "no such account or incorrect password",
+	401:  "account disabled",
+	402:  "permission denied",
+	403:  "2-step verification code required",
+	404:  "failed to authenticate 2-step verification code",
+	406:  "enforce to authenticate with 2-factor authentication code",
+	407:  "blocked IP source",
+	408:  "expired password cannot change",
+	409:  "expired password",
+	410:  "password must be changed",
+	1800: "no file was uploaded or the upload was interrupted",
+	1801: "the upload timed out",
+	1802: "no file name given for the upload",
+	1803: "the upload was cancelled",
+	1804: "the file is too big for the target file system",
+	1805: "the file already exists and may not be overwritten",
+}
+
+// APIError is an error reported by the DSM Web API
+type APIError struct {
+	API  string
+	Code int
+}
+
+// Error implements error
+func (e *APIError) Error() string {
+	if message, ok := errorMessages[e.Code]; ok {
+		return fmt.Sprintf("%s failed with error %d: %s", e.API, e.Code, message)
+	}
+	return fmt.Sprintf("%s failed with error %d", e.API, e.Code)
+}
+
+// apiInfo is where an API is served and which versions it supports
+type apiInfo struct {
+	Path       string `json:"path"`
+	MinVersion int    `json:"minVersion"`
+	MaxVersion int    `json:"maxVersion"`
+}
+
+// response is the envelope of every Web API response
+type response struct {
+	Success bool            `json:"success"`
+	Data    json.RawMessage `json:"data"`
+	Error   *struct {
+		Code int `json:"code"`
+	} `json:"error"`
+}
+
+// Client talks to a single DSM instance. It is not safe for concurrent use.
+type Client struct {
+	baseURL    string
+	httpClient *http.Client
+
+	apis map[string]apiInfo
+	sid  string
+}
+
+// NewClient creates a client for the DSM at baseURL, such as
+// "https://nas.local:5001". A nil httpClient uses http.DefaultClient.
+func NewClient(baseURL string, httpClient *http.Client) *Client {
+	if httpClient == nil {
+		httpClient = http.DefaultClient
+	}
+	return &Client{
+		baseURL:    strings.TrimRight(baseURL, "/"),
+		httpClient: httpClient,
+	}
+}
+
+// Login looks up the APIs the DSM offers and starts a session. otp is the
+// 2-step verification code, or "" if the account does not use one.
+func (c *Client) Login(ctx context.Context, account, password, otp string) error {
+	if err := c.discover(ctx); err != nil {
+		return err
+	}
+
+	form := url.Values{
+		"account": {account},
+		"passwd":  {password},
+		"session": {session},
+		"format":  {"sid"},
+	}
+	if otp != "" {
+		form.Set("otp_code", otp)
+	}
+
+	var data struct {
+		SID string `json:"sid"`
+	}
+	if err := c.call(ctx, APIAuth, "login", 3, form, &data); err != nil {
+		return err
+	}
+	if data.SID == "" {
+		return fmt.Errorf("%s returned no session ID", APIAuth)
+	}
+	c.sid = data.SID
+	return nil
+}
+
+// Logout ends the session
+func (c *Client) Logout(ctx context.Context) error {
+	if c.sid == "" {
+		return nil
+	}
+	err := c.call(ctx, APIAuth, "logout", 3, url.Values{"session": {session}}, nil)
+	c.sid = ""
+	return err
+}
+
+// Upload copies a local file into folder on the DSM, creating the folder if
+// needed and replacing a file of the same name. It returns the file's path
+// on the DSM.
+func (c *Client) Upload(ctx context.Context, folder, localPath string) (string, error) {
+	info, ok := c.apis[APIUpload]
+	if !ok {
+		return "", fmt.Errorf("%s is not available on this DSM", APIUpload)
+	}
+	file, err := os.Open(localPath)
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+
+	// Stream the file instead of holding it in memory
+	name := filepath.Base(localPath)
+	body, writer := io.Pipe()
+	form := multipart.NewWriter(writer)
+	go func() {
+		fields := [][2]string{
+			{"api", APIUpload},
+			{"version", strconv.Itoa(info.version(2))},
+			{"method", "upload"},
+			{"path", folder},
+			{"create_parents", "true"},
+			{"overwrite", "true"},
+		}
+		for _, field := range fields {
+			if err := form.WriteField(field[0], field[1]); err != nil {
+				writer.CloseWithError(err)
+				return
+			}
+		}
+		// The file must be the last part of the form
+		part, err := form.CreateFormFile("file", name)
+		if err == nil {
+			_, err = io.Copy(part, file)
+		}
+		if err == nil {
+			err = form.Close()
+		}
+		writer.CloseWithError(err)
+	}()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, c.endpoint(info, url.Values{"_sid": {c.sid}}), body)
+	if err != nil {
+		body.Close()
+		return "", err
+	}
+	req.Header.Set("Content-Type", form.FormDataContentType())
+	if err := c.do(req, APIUpload, nil); err != nil {
+		body.Close()
+		return "", err
+	}
+
+	return path.Join(folder, name), nil
+}
+
+// discover asks the DSM which APIs it offers and where
+func (c *Client) discover(ctx context.Context) error {
+	query := url.Values{
+		"api":     {APIInfo},
+		"version": {"1"},
+		"method":  {"query"},
+		"query":   {APIAuth + "," + APIUpload},
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, c.baseURL+"/webapi/query.cgi?"+query.Encode(), nil)
+	if err != nil {
+		return err
+	}
+
+	apis := make(map[string]apiInfo)
+	if err := c.do(req, APIInfo, &apis); err != nil {
+		return err
+	}
+	if _, ok := apis[APIAuth]; !ok {
+		return fmt.Errorf("%s is not available on this DSM", APIAuth)
+	}
+	c.apis = apis
+	return nil
+}
+
+// call posts a form to an API method and decodes the data of the response
+// into data, which may be nil
+func (c *Client) call(ctx context.Context, api, method string, preferredVersion int, form url.Values, data any) error {
+	info, ok := c.apis[api]
+	if !ok {
+		return fmt.Errorf("%s is not available on this DSM", api)
+	}
+
+	form.Set("api", api)
+	form.Set("version", strconv.Itoa(info.version(preferredVersion)))
+	form.Set("method", method)
+	query := url.Values{}
+	if c.sid != "" {
+		query.Set("_sid", c.sid)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, c.endpoint(info, query), strings.NewReader(form.Encode()))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	return c.do(req, api, data)
+}
+
+// do sends a request and decodes the data of a successful response
+func (c *Client) do(req *http.Request, api string, data any) error {
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to call %s: %w", api, err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("failed to call %s: %s", api, resp.Status)
+	}
+
+	var result response
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return fmt.Errorf("failed to decode %s response: %w", api, err)
+	}
+	if !result.Success {
+		code := 100
+		if result.Error != nil {
+			code = result.Error.Code
+		}
+		return &APIError{API: api, Code: code}
+	}
+	if data != nil && len(result.Data) > 0 {
+		if err := json.Unmarshal(result.Data, data); err != nil {
+			return fmt.Errorf("failed to decode %s response: %w", api, err)
+		}
+	}
+	return nil
+}
+
+// endpoint returns the URL an API is served at
+func (c *Client) endpoint(info apiInfo, query url.Values) string {
+	endpoint := c.baseURL + "/webapi/" + info.Path
+	if len(query) > 0 {
+		endpoint += "?" + query.Encode()
+	}
+	return endpoint
+}
+
+// version returns preferred if the API supports it, otherwise the closest
+// supported version
+func (info apiInfo) version(preferred int) int {
+	if info.MaxVersion == 0 {
+		return preferred
+	}
+	return max(info.MinVersion, min(preferred, info.MaxVersion))
+}
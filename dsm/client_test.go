@@ -0,0 +1,246 @@
+package dsm_test
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/clark-ioe/md2nsx/dsm"
+	"github.com/clark-ioe/md2nsx/dsm/dsmtest"
+)
+
+// recordedRequest is what the tests check about a request the client sent
+type recordedRequest struct {
+	path          string
+	api           string
+	method        string
+	version       string
+	sid           string
+	contentLength int64
+	otp           string
+}
+
+// fakeDSM serves a dsmtest.Server and records the requests it receives
+type fakeDSM struct {
+	*dsmtest.Server
+	url string
+
+	mu       sync.Mutex
+	requests []recordedRequest
+}
+
+// newFakeDSM starts a fake DSM accepting admin/secret
+func newFakeDSM(t *testing.T) *fakeDSM {
+	t.Helper()
+	fake := &fakeDSM{Server: dsmtest.NewServer("admin", "secret")}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		request := recordedRequest{
+			path:          r.URL.Path,
+			sid:           r.URL.Query().Get("_sid"),
+			contentLength: r.ContentLength,
+		}
+		// Upload forms are streamed and left to the server to read
+		if !strings.HasPrefix(r.Header.Get("Content-Type"), "multipart/") {
+			request.api = r.FormValue("api")
+			request.method = r.FormValue("method")
+			request.version = r.FormValue("version")
+			request.otp = r.FormValue("otp_code")
+		}
+		fake.mu.Lock()
+		fake.requests = append(fake.requests, request)
+		fake.mu.Unlock()
+		fake.Server.ServeHTTP(w, r)
+	}))
+	t.Cleanup(server.Close)
+	fake.url = server.URL
+	return fake
+}
+
+// recorded returns the requests received so far
+func (f *fakeDSM) recorded() []recordedRequest {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return append([]recordedRequest(nil), f.requests...)
+}
+
+func TestLoginDiscoversAPIs(t *testing.T) {
+	fake := newFakeDSM(t)
+	client := dsm.NewClient(fake.url+"/", nil)
+
+	if err := client.Login(context.Background(), "admin", "secret", ""); err != nil {
+		t.Fatalf("Login failed: %v", err)
+	}
+	if fake.Sessions() != 1 {
+		t.Errorf("%d sessions after login, want 1", fake.Sessions())
+	}
+
+	requests := fake.recorded()
+	if len(requests) != 2 {
+		t.Fatalf("Login sent %d requests, want discovery and login", len(requests))
+	}
+	if discovery := requests[0]; discovery.path != "/webapi/query.cgi" || discovery.api != dsm.APIInfo || discovery.method != "query" {
+		t.Errorf("first request is %+v, want an API discovery", discovery)
+	}
+	login := requests[1]
+	if login.path != "/webapi/auth.cgi" || login.api != dsm.APIAuth || login.method != "login" || login.version != "3" {
+		t.Errorf("second request is %+v, want a version 3 login at the discovered path", login)
+	}
+	if login.otp != "" {
+		t.Errorf("login sent otp_code %q without a code", login.otp)
+	}
+}
+
+func TestLoginErrors(t *testing.T) {
+	tests := []struct {
+		name     string
+		password string
+		otp      string
+		code     int
+	}{
+		{"wrong password", "wrong", "", 400},
+		{"missing code", "secret", "", 403},
+		{"wrong code", "secret", "000000", 404},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			fake := newFakeDSM(t)
+			fake.OTP = "123456"
+			client := dsm.NewClient(fake.url, nil)
+
+			err := client.Login(context.Background(), "admin", test.password, test.otp)
+			var apiErr *dsm.APIError
+			if !errors.As(err, &apiErr) || apiErr.Code != test.code || apiErr.API != dsm.APIAuth {
+				t.Fatalf("Login returned %v, want %s error %d", err, dsm.APIAuth, test.code)
+			}
+			if fake.Sessions() != 0 {
+				t.Errorf("failed login left %d sessions", fake.Sessions())
+			}
+		})
+	}
+
+	if message := (&dsm.APIError{API: dsm.APIAuth, Code: 403}).Error(); !strings.Contains(message, "2-step verification code required") {
+		t.Errorf("error 403 is described as %q", message)
+	}
+}
+
+func TestLoginWithOTP(t *testing.T) {
+	fake := newFakeDSM(t)
+	fake.OTP = "123456"
+	client := dsm.NewClient(fake.url, nil)
+
+	if err := client.Login(context.Background(), "admin", "secret", "123456"); err != nil {
+		t.Fatalf("Login with the right code failed: %v", err)
+	}
+	requests := fake.recorded()
+	if otp := requests[len(requests)-1].otp; otp != "123456" {
+		t.Errorf("login sent otp_code %q, want 123456", otp)
+	}
+}
+
+func TestUploadAndLogout(t *testing.T) {
+	fake := newFakeDSM(t)
+	client := dsm.NewClient(fake.url, nil)
+	ctx := context.Background()
+
+	content := bytes.Repeat([]byte("nsx"), 100000)
+	localPath := filepath.Join(t.TempDir(), "notes.nsx")
+	if err := os.WriteFile(localPath, content, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := client.Upload(ctx, "/home", localPath); err == nil {
+		t.Errorf("Upload before Login succeeded")
+	}
+
+	if err := client.Login(ctx, "admin", "secret", ""); err != nil {
+		t.Fatal(err)
+	}
+	remotePath, err := client.Upload(ctx, "/home/imports", localPath)
+	if err != nil {
+		t.Fatalf("Upload failed: %v", err)
+	}
+	if remotePath != "/home/imports/notes.nsx" {
+		t.Errorf("Upload returned %q, want /home/imports/notes.nsx", remotePath)
+	}
+	if uploaded, ok := fake.File(remotePath); !ok || !bytes.Equal(uploaded, content) {
+		t.Errorf("the fake DSM received %d bytes, want the %d bytes of the file", len(uploaded), len(content))
+	}
+
+	requests := fake.recorded()
+	upload := requests[len(requests)-1]
+	if upload.path != "/webapi/entry.cgi" || upload.sid == "" {
+		t.Errorf("upload request is %+v, want entry.cgi with a session ID", upload)
+	}
+	if upload.contentLength != -1 {
+		t.Errorf("upload sent a Content-Length of %d, want a streamed body", upload.contentLength)
+	}
+
+	// Uploading again replaces the file
+	if _, err := client.Upload(ctx, "/home/imports", localPath); err != nil {
+		t.Errorf("second Upload failed: %v", err)
+	}
+
+	if err := client.Logout(ctx); err != nil {
+		t.Fatalf("Logout failed: %v", err)
+	}
+	if fake.Sessions() != 0 {
+		t.Errorf("%d sessions after logout, want 0", fake.Sessions())
+	}
+	requests = fake.recorded()
+	if logout := requests[len(requests)-1]; logout.method != "logout" || logout.sid != upload.sid {
+		t.Errorf("last request is %+v, want a logout of the session", logout)
+	}
+
+	// Logging out again does nothing
+	count := len(fake.recorded())
+	if err := client.Logout(ctx); err != nil || len(fake.recorded()) != count {
+		t.Errorf("second Logout sent a request or failed: %v", err)
+	}
+}
+
+func TestUploadMissingFile(t *testing.T) {
+	fake := newFakeDSM(t)
+	client := dsm.NewClient(fake.url, nil)
+	if err := client.Login(context.Background(), "admin", "secret", ""); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := client.Upload(context.Background(), "/home", filepath.Join(t.TempDir(), "missing.nsx")); err == nil {
+		t.Errorf("Upload of a missing file succeeded")
+	}
+}
+
+func TestUnexpectedResponses(t *testing.T) {
+	tests := []struct {
+		name    string
+		handler http.HandlerFunc
+		want    string
+	}{
+		{"HTTP error", func(w http.ResponseWriter, r *http.Request) {
+			http.Error(w, "down for maintenance", http.StatusServiceUnavailable)
+		}, "503"},
+		{"not JSON", func(w http.ResponseWriter, r *http.Request) {
+			w.Write([]byte("<html>login</html>"))
+		}, "decode"},
+		{"no auth API", func(w http.ResponseWriter, r *http.Request) {
+			w.Write([]byte(`{"success": true, "data": {}}`))
+		}, dsm.APIAuth + " is not available"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			server := httptest.NewServer(test.handler)
+			defer server.Close()
+
+			err := dsm.NewClient(server.URL, nil).Login(context.Background(), "admin", "secret", "")
+			if err == nil || !strings.Contains(err.Error(), test.want) {
+				t.Errorf("Login returned %v, want an error containing %q", err, test.want)
+			}
+		})
+	}
+}
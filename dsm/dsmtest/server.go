@@ -0,0 +1,274 @@
+// Package dsmtest is a stand-in for the parts of the DSM Web API that the dsm
+// package uses: API discovery, login and logout, and File Station uploads.
+// It is meant for tests and for trying out uploads without a NAS.
+//
+//	server := httptest.NewServer(dsmtest.NewServer("admin", "secret"))
+//	defer server.Close()
+//	client := dsm.NewClient(server.URL, nil)
+package dsmtest
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"log/slog"
+	"mime/multipart"
+	"net/http"
+	"path"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// apis are the Web APIs the server offers
+var apis = map[string]apiInfo{
+	"SYNO.API.Info":           {Path: "query.cgi", MinVersion: 1, MaxVersion: 1},
+	"SYNO.API.Auth":           {Path: "auth.cgi", MinVersion: 1, MaxVersion: 7},
+	"SYNO.FileStation.Upload": {Path: "entry.cgi", MinVersion: 1, MaxVersion: 3},
+}
+
+// apiInfo is an entry of the API discovery response
+type apiInfo struct {
+	Path       string `json:"path"`
+	MinVersion int    `json:"minVersion"`
+	MaxVersion int    `json:"maxVersion"`
+}
+
+// Server is a fake DSM that accepts a single account and keeps uploaded files
+// in memory. It is safe for concurrent use.
+type Server struct {
+	// Account and Password are the credentials login accepts
+	Account  string
+	Password string
+	// OTP, if set, is the 2-step verification code login requires
+	OTP string
+	// Logger, if set, receives a message for every login, logout and upload
+	Logger *slog.Logger
+
+	mu       sync.Mutex
+	sessions map[string]bool
+	files    map[string][]byte
+}
+
+// NewServer creates a server accepting the given account
+func NewServer(account, password string) *Server {
+	return &Server{
+		Account:  account,
+		Password: password,
+		sessions: make(map[string]bool),
+		files:    make(map[string][]byte),
+	}
+}
+
+// File returns the content of an uploaded file by its DSM path
+func (s *Server) File(remotePath string) ([]byte, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	data, ok := s.files[remotePath]
+	return data, ok
+}
+
+// Sessions returns the number of sessions that are logged in
+func (s *Server) Sessions() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return len(s.sessions)
+}
+
+// ServeHTTP implements http.Handler
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	switch r.URL.Path {
+	case "/webapi/query.cgi":
+		s.handleInfo(w, r)
+	case "/webapi/auth.cgi":
+		s.handleAuth(w, r)
+	case "/webapi/entry.cgi":
+		s.handleEntry(w, r)
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+// handleInfo answers SYNO.API.Info queries for a comma-separated list of
+// APIs or "ALL"
+func (s *Server) handleInfo(w http.ResponseWriter, r *http.Request) {
+	if code := checkAPI(r.FormValue("api"), "SYNO.API.Info", r.FormValue("version")); code != 0 {
+		fail(w, code)
+		return
+	}
+	if r.FormValue("method") != "query" {
+		fail(w, 103)
+		return
+	}
+
+	found := make(map[string]apiInfo)
+	for _, name := range strings.Split(r.FormValue("query"), ",") {
+		if name == "ALL" {
+			found = apis
+			break
+		}
+		if info, ok := apis[name]; ok {
+			found[name] = info
+		}
+	}
+	succeed(w, found)
+}
+
+// handleAuth handles SYNO.API.Auth login and logout
+func (s *Server) handleAuth(w http.ResponseWriter, r *http.Request) {
+	if code := checkAPI(r.FormValue("api"), "SYNO.API.Auth", r.FormValue("version")); code != 0 {
+		fail(w, code)
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	switch r.FormValue("method") {
+	case "login":
+		switch {
+		case r.FormValue("account") != s.Account || r.FormValue("passwd") != s.Password:
+			s.log("Login failed", "account", r.FormValue("account"))
+			fail(w, 400)
+			return
+		case s.OTP != "" && r.FormValue("otp_code") == "":
+			fail(w, 403)
+			return
+		case s.OTP != "" && r.FormValue("otp_code") != s.OTP:
+			fail(w, 404)
+			return
+		}
+		buf := make([]byte, 16)
+		_, _ = rand.Read(buf)
+		sid := hex.EncodeToString(buf)
+		s.sessions[sid] = true
+		s.log("Logged in", "account", s.Account)
+		succeed(w, map[string]string{"sid": sid})
+	case "logout":
+		sid := r.URL.Query().Get("_sid")
+		if !s.sessions[sid] {
+			fail(w, 119)
+			return
+		}
+		delete(s.sessions, sid)
+		s.log("Logged out")
+		succeed(w, nil)
+	default:
+		fail(w, 103)
+	}
+}
+
+// handleEntry handles SYNO.FileStation.Upload. Like a real DSM it reads the
+// form as a stream, so the file must come after the other fields.
+func (s *Server) handleEntry(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	loggedIn := s.sessions[r.URL.Query().Get("_sid")]
+	s.mu.Unlock()
+	if !loggedIn {
+		fail(w, 119)
+		return
+	}
+
+	reader, err := r.MultipartReader()
+	if err != nil {
+		fail(w, 101)
+		return
+	}
+	fields := make(map[string]string)
+	for {
+		part, err := reader.NextPart()
+		if err == io.EOF {
+			fail(w, 1800)
+			return
+		}
+		if err != nil {
+			fail(w, 101)
+			return
+		}
+		if part.FormName() == "file" {
+			s.upload(w, fields, part)
+			return
+		}
+		value, err := io.ReadAll(part)
+		if err != nil {
+			fail(w, 101)
+			return
+		}
+		fields[part.FormName()] = string(value)
+	}
+}
+
+// upload stores the file of an upload request
+func (s *Server) upload(w http.ResponseWriter, fields map[string]string, file *multipart.Part) {
+	if code := checkAPI(fields["api"], "SYNO.FileStation.Upload", fields["version"]); code != 0 {
+		fail(w, code)
+		return
+	}
+	if fields["method"] != "upload" {
+		fail(w, 103)
+		return
+	}
+	folder := fields["path"]
+	if !strings.HasPrefix(folder, "/") {
+		fail(w, 101)
+		return
+	}
+	if file.FileName() == "" {
+		fail(w, 1802)
+		return
+	}
+	data, err := io.ReadAll(file)
+	if err != nil {
+		fail(w, 1800)
+		return
+	}
+
+	remotePath := path.Join(folder, file.FileName())
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, exists := s.files[remotePath]; exists && fields["overwrite"] != "true" {
+		fail(w, 1805)
+		return
+	}
+	s.files[remotePath] = data
+	s.log("Uploaded", "path", remotePath, "bytes", len(data))
+	succeed(w, nil)
+}
+
+// log sends a message to the logger, if any
+func (s *Server) log(message string, args ...any) {
+	if s.Logger != nil {
+		s.Logger.Info(message, args...)
+	}
+}
+
+// checkAPI returns the error code for a request to the wrong API or an
+// unsupported version, or 0
+func checkAPI(api, want, version string) int {
+	if api != want {
+		return 102
+	}
+	info := apis[want]
+	v, err := strconv.Atoi(version)
+	if err != nil || v < info.MinVersion || v > info.MaxVersion {
+		return 104
+	}
+	return 0
+}
+
+// succeed writes a successful Web API response
+func succeed(w http.ResponseWriter, data any) {
+	writeJSON(w, map[string]any{"success": true, "data": data})
+}
+
+// fail writes a Web API error response
+func fail(w http.ResponseWriter, code int) {
+	writeJSON(w, map[string]any{"success": false, "error": map[string]int{"code": code}})
+}
+
+// writeJSON writes a JSON response
+func writeJSON(w http.ResponseWriter, value any) {
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(value)
+}
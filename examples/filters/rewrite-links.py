@@ -0,0 +1,26 @@
+#!/usr/bin/env python3
+"""Example md2nsx filter.
+
+md2nsx writes one note as JSON to stdin and reads the transformed note from
+stdout. In the markdown stage, this filter rewrites links to an internal wiki
+and uses the "title" front matter field as the note title. In the html stage,
+it appends a footer naming the source file.
+
+    md2nsx convert ./notes --filter "python3 examples/filters/rewrite-links.py"
+    md2nsx convert ./notes --html-filter "python3 examples/filters/rewrite-links.py"
+"""
+
+import json
+import sys
+
+doc = json.load(sys.stdin)
+
+if doc["stage"] == "markdown":
+    doc["content"] = doc["content"].replace("https://wiki.internal/", "https://wiki.example.com/")
+    title = doc["front_matter"].get("title")
+    if title:
+        doc["title"] = str(title)
+elif doc["stage"] == "html":
+    doc["content"] += "<p><small>Imported from {}</small></p>".format(doc["source"])
+
+json.dump(doc, sys.stdout)
@@ -0,0 +1,34 @@
+// Command mock-dsm serves the stand-in DSM of the dsmtest package, for trying
+// out "md2nsx --upload" without a Synology NAS. Uploaded files are kept in
+// memory.
+//
+//	go run ./examples/mock-dsm -listen 127.0.0.1:5000 -user admin -password secret
+//	MD2NSX_DSM_PASSWORD=secret md2nsx convert ./notes --upload --dsm-url http://127.0.0.1:5000 --dsm-user admin
+package main
+
+import (
+	"flag"
+	"log/slog"
+	"net/http"
+	"os"
+
+	"github.com/clark-ioe/md2nsx/dsm/dsmtest"
+)
+
+func main() {
+	listen := flag.String("listen", "127.0.0.1:5000", "address to listen on")
+	user := flag.String("user", "admin", "account accepted by the login")
+	password := flag.String("password", "secret", "password accepted by the login")
+	otp := flag.String("otp", "", "2-step verification code required by the login")
+	flag.Parse()
+
+	server := dsmtest.NewServer(*user, *password)
+	server.OTP = *otp
+	server.Logger = slog.Default()
+
+	slog.Info("Mock DSM listening", "addr", *listen, "user", *user)
+	if err := http.ListenAndServe(*listen, server); err != nil {
+		slog.Error("Mock DSM stopped", "error", err)
+		os.Exit(1)
+	}
+}
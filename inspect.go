@@ -0,0 +1,304 @@
+package main
+
+import (
+	"archive/zip"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/clark-ioe/md2nsx/nsx"
+	"github.com/spf13/cobra"
+)
+
+// nsxArchive is an NSX file opened for reading
+type nsxArchive struct {
+	reader    *zip.ReadCloser
+	entries   map[string]*zip.File
+	config    nsx.NotebookConfig
+	notebooks map[string]nsx.Notebook
+	notes     map[string]nsx.Note
+}
+
+// openNSX opens an NSX file and parses its config, notebooks and notes.
+// Entries that fail to parse are reported through the returned problems.
+func openNSX(path string) (*nsxArchive, []string, error) {
+	reader, err := zip.OpenReader(path)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to open NSX file: %w", err)
+	}
+
+	archive := &nsxArchive{
+		reader:    reader,
+		entries:   make(map[string]*zip.File),
+		notebooks: make(map[string]nsx.Notebook),
+		notes:     make(map[string]nsx.Note),
+	}
+	for _, file := range reader.File {
+		archive.entries[file.Name] = file
+	}
+
+	if err := archive.readJSON("config.json", &archive.config); err != nil {
+		_ = reader.Close()
+		return nil, nil, fmt.Errorf("invalid config.json: %w", err)
+	}
+
+	problems := make([]string, 0)
+	for _, notebookID := range archive.config.Notebook {
+		var notebook nsx.Notebook
+		if err := archive.readJSON(notebookID, &notebook); err != nil {
+			problems = append(problems, fmt.Sprintf("notebook %s: %v", notebookID, err))
+			continue
+		}
+		archive.notebooks[notebookID] = notebook
+	}
+	for _, noteID := range archive.config.Note {
+		var note nsx.Note
+		if err := archive.readJSON(noteID, &note); err != nil {
+			problems = append(problems, fmt.Sprintf("note %s: %v", noteID, err))
+			continue
+		}
+		archive.notes[noteID] = note
+	}
+
+	return archive, problems, nil
+}
+
+// Close closes the underlying zip file
+func (a *nsxArchive) Close() error {
+	return a.reader.Close()
+}
+
+// readJSON decodes the named entry into v
+func (a *nsxArchive) readJSON(name string, v any) error {
+	file, ok := a.entries[name]
+	if !ok {
+		return fmt.Errorf("entry is missing")
+	}
+
+	reader, err := file.Open()
+	if err != nil {
+		return err
+	}
+	defer reader.Close()
+
+	return json.NewDecoder(reader).Decode(v)
+}
+
+// sortedKeys returns the attachment keys of a note in a stable order
+func sortedKeys(attachments map[string]nsx.Attachment) []string {
+	keys := make([]string, 0, len(attachments))
+	for key := range attachments {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// newInspectCommand builds "md2nsx inspect"
+func newInspectCommand() *cobra.Command {
+	return &cobra.Command{
+		Use:   "inspect <file.nsx>",
+		Short: "List the notebooks, notes and attachments in an NSX file",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			archive, problems, err := openNSX(args[0])
+			if err != nil {
+				return err
+			}
+			defer archive.Close()
+
+			out := cmd.OutOrStdout()
+			fmt.Fprintf(out, "Notebooks: %d\n", len(archive.config.Notebook))
+			for _, notebookID := range archive.config.Notebook {
+				fmt.Fprintf(out, "  %s  %s\n", notebookID, archive.notebooks[notebookID].Title)
+			}
+
+			fmt.Fprintf(out, "Notes: %d\n", len(archive.config.Note))
+			for _, noteID := range archive.config.Note {
+				note, ok := archive.notes[noteID]
+				if !ok {
+					continue
+				}
+				fmt.Fprintf(out, "  %s  %s (%d bytes, %d attachments)\n", noteID, note.Title, len(note.Content), len(note.Attachment))
+				for _, fileKey := range sortedKeys(note.Attachment) {
+					attachment := note.Attachment[fileKey]
+					fmt.Fprintf(out, "    %s  %s (%s, %d bytes)\n", fileKey, attachment.Name, attachment.Type, attachment.Size)
+				}
+			}
+
+			files := 0
+			for name := range archive.entries {
+				if strings.HasPrefix(name, "file_") {
+					files++
+				}
+			}
+			fmt.Fprintf(out, "Stored files: %d\n", files)
+
+			for _, problem := range problems {
+				logger.Warn(problem)
+			}
+			return nil
+		},
+	}
+}
+
+// newValidateCommand builds "md2nsx validate"
+func newValidateCommand() *cobra.Command {
+	return &cobra.Command{
+		Use:   "validate <file.nsx>",
+		Short: "Check that an NSX file is complete and consistent",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			archive, problems, err := openNSX(args[0])
+			if err != nil {
+				return err
+			}
+			defer archive.Close()
+
+			warnings := make([]string, 0)
+			for _, noteID := range archive.config.Note {
+				note, ok := archive.notes[noteID]
+				if !ok {
+					continue
+				}
+				if _, ok := archive.notebooks[note.ParentID]; !ok {
+					problems = append(problems, fmt.Sprintf("note %s: parent notebook %s is not in the archive", noteID, note.ParentID))
+				}
+				for _, fileKey := range sortedKeys(note.Attachment) {
+					attachment := note.Attachment[fileKey]
+					if _, ok := archive.entries["file_"+attachment.MD5]; ok {
+						continue
+					}
+					if strings.HasPrefix(attachment.Type, "image/") {
+						problems = append(problems, fmt.Sprintf("note %s: image %s has no stored data", noteID, attachment.Name))
+					} else {
+						warnings = append(warnings, fmt.Sprintf("note %s: attachment %s has no stored data", noteID, attachment.Name))
+					}
+				}
+			}
+
+			for _, warning := range warnings {
+				logger.Warn(warning)
+			}
+			for _, problem := range problems {
+				logger.Error(problem)
+			}
+			if len(problems) > 0 {
+				return fmt.Errorf("%s is not valid: %d problems found", args[0], len(problems))
+			}
+
+			fmt.Fprintf(cmd.OutOrStdout(), "%s is valid: %d notebooks, %d notes\n", args[0], len(archive.notebooks), len(archive.notes))
+			return nil
+		},
+	}
+}
+
+// newExportCommand builds "md2nsx export"
+func newExportCommand() *cobra.Command {
+	return &cobra.Command{
+		Use:   "export <file.nsx> <output_folder>",
+		Short: "Extract the notes of an NSX file as HTML files with their attachments",
+		Args:  cobra.ExactArgs(2),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			archive, problems, err := openNSX(args[0])
+			if err != nil {
+				return err
+			}
+			defer archive.Close()
+
+			for _, problem := range problems {
+				logger.Warn(problem)
+			}
+
+			outputDir := args[1]
+			if err := os.MkdirAll(outputDir, 0755); err != nil {
+				return fmt.Errorf("failed to create output folder: %w", err)
+			}
+
+			// exported maps every file name written to the note ID or
+			// attachment hash it was written for
+			exported := make(map[string]string)
+			for _, noteID := range archive.config.Note {
+				note, ok := archive.notes[noteID]
+				if !ok {
+					continue
+				}
+
+				// Titles need not be unique, so later notes with a title
+				// already exported get their ID added
+				noteName := safeFilename(note.Title) + ".html"
+				if exported[noteName] != "" {
+					noteName = safeFilename(note.Title+" "+noteID) + ".html"
+				}
+				exported[noteName] = noteID
+				notePath := filepath.Join(outputDir, noteName)
+				if err := os.WriteFile(notePath, []byte(note.Content), 0644); err != nil {
+					return fmt.Errorf("failed to write note %s: %w", note.Title, err)
+				}
+				logger.Info("Exported", "file", notePath)
+
+				for _, fileKey := range sortedKeys(note.Attachment) {
+					attachment := note.Attachment[fileKey]
+					file, ok := archive.entries["file_"+attachment.MD5]
+					if !ok {
+						continue
+					}
+					// Notes often share an attachment; different files with the
+					// same name get part of their hash added
+					attachmentName := safeFilename(attachment.Name)
+					if owner := exported[attachmentName]; owner == attachment.MD5 {
+						continue
+					} else if owner != "" {
+						ext := filepath.Ext(attachmentName)
+						attachmentName = strings.TrimSuffix(attachmentName, ext) + "-" + attachment.MD5[:min(8, len(attachment.MD5))] + ext
+					}
+					exported[attachmentName] = attachment.MD5
+					attachmentPath := filepath.Join(outputDir, attachmentName)
+					if err := extractFile(file, attachmentPath); err != nil {
+						return fmt.Errorf("failed to write attachment %s: %w", attachment.Name, err)
+					}
+				}
+			}
+
+			return nil
+		},
+	}
+}
+
+// extractFile copies a zip entry to a file on disk
+func extractFile(file *zip.File, path string) error {
+	reader, err := file.Open()
+	if err != nil {
+		return err
+	}
+	defer reader.Close()
+
+	out, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(out, reader); err != nil {
+		_ = out.Close()
+		return err
+	}
+	return out.Close()
+}
+
+// safeFilename makes a note title or attachment name usable as a file name
+func safeFilename(name string) string {
+	name = strings.Map(func(r rune) rune {
+		switch r {
+		case '/', '\\', ':', '*', '?', '"', '<', '>', '|':
+			return '_'
+		}
+		return r
+	}, name)
+	if name == "" || name == "." || name == ".." {
+		return "untitled"
+	}
+	return name
+}
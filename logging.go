@@ -0,0 +1,142 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// logger receives every progress, warning and error message. It writes to
+// stderr so stdout only carries data, such as an archive streamed with -o -
+// or a dry-run plan.
+var logger = slog.New(newPlainHandler(os.Stderr, slog.LevelInfo))
+
+// setupLogging replaces logger according to the --quiet, --verbose and
+// --log-format flags
+func setupLogging(out io.Writer, quiet, verbose bool, format string) error {
+	level := slog.LevelInfo
+	switch {
+	case quiet && verbose:
+		return fmt.Errorf("--quiet and --verbose cannot be used together")
+	case quiet:
+		level = slog.LevelWarn
+	case verbose:
+		level = slog.LevelDebug
+	}
+
+	switch format {
+	case "text":
+		// On a terminal, log lines are printed above the progress bar
+		status = nil
+		if isTerminal(out) {
+			status = &statusLine{out: out}
+			out = status
+		}
+		logger = slog.New(newPlainHandler(out, level))
+	case "json":
+		logger = slog.New(slog.NewJSONHandler(out, &slog.HandlerOptions{Level: level}))
+	default:
+		return fmt.Errorf("unknown log format '%s' (use text or json)", format)
+	}
+	return nil
+}
+
+// plainHandler writes each record as a single human readable line: the
+// message followed by its attributes as key=value pairs. Warnings and errors
+// are prefixed with "Warning:" and "Error:".
+type plainHandler struct {
+	mu     *sync.Mutex
+	out    io.Writer
+	level  slog.Leveler
+	attrs  string
+	prefix string
+}
+
+// newPlainHandler creates a handler that writes records at or above level
+func newPlainHandler(out io.Writer, level slog.Leveler) *plainHandler {
+	return &plainHandler{
+		mu:    &sync.Mutex{},
+		out:   out,
+		level: level,
+	}
+}
+
+// Enabled reports whether records of the given level are written
+func (h *plainHandler) Enabled(_ context.Context, level slog.Level) bool {
+	return level >= h.level.Level()
+}
+
+// Handle writes a record
+func (h *plainHandler) Handle(_ context.Context, record slog.Record) error {
+	var buf bytes.Buffer
+	switch {
+	case record.Level >= slog.LevelError:
+		buf.WriteString("Error: ")
+	case record.Level >= slog.LevelWarn:
+		buf.WriteString("Warning: ")
+	}
+	buf.WriteString(record.Message)
+	buf.WriteString(h.attrs)
+	record.Attrs(func(attr slog.Attr) bool {
+		appendAttr(&buf, h.prefix, attr)
+		return true
+	})
+	buf.WriteByte('\n')
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	_, err := h.out.Write(buf.Bytes())
+	return err
+}
+
+// WithAttrs returns a handler that adds attrs to every record
+func (h *plainHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	var buf bytes.Buffer
+	for _, attr := range attrs {
+		appendAttr(&buf, h.prefix, attr)
+	}
+	clone := *h
+	clone.attrs = h.attrs + buf.String()
+	return &clone
+}
+
+// WithGroup returns a handler that qualifies later attribute keys with name
+func (h *plainHandler) WithGroup(name string) slog.Handler {
+	if name == "" {
+		return h
+	}
+	clone := *h
+	clone.prefix = h.prefix + name + "."
+	return &clone
+}
+
+// appendAttr writes " key=value", expanding groups into dotted keys and
+// quoting values that contain spaces
+func appendAttr(buf *bytes.Buffer, prefix string, attr slog.Attr) {
+	attr.Value = attr.Value.Resolve()
+	if attr.Equal(slog.Attr{}) {
+		return
+	}
+
+	if attr.Value.Kind() == slog.KindGroup {
+		if attr.Key != "" {
+			prefix += attr.Key + "."
+		}
+		for _, member := range attr.Value.Group() {
+			appendAttr(buf, prefix, member)
+		}
+		return
+	}
+
+	value := attr.Value.String()
+	if value == "" || strings.ContainsAny(value, " \t\n\"=") {
+		value = strconv.Quote(value)
+	}
+	fmt.Fprintf(buf, " %s%s=%s", prefix, attr.Key, value)
+}
@@ -1,50 +1,65 @@
 package main
 
 import (
-	"flag"
+	"context"
 	"fmt"
-	"log"
 	"os"
+	"os/signal"
+	"strconv"
+	"strings"
+	"syscall"
 )
 
 func main() {
-	// Parse command line arguments
-	var notebookName string
-	flag.StringVar(&notebookName, "notebook", "Imported Notebook", "Notebook name")
-	flag.StringVar(&notebookName, "n", "Imported Notebook", "Short form for notebook name")
-	flag.Parse()
-
-	args := flag.Args()
-	if len(args) < 1 {
-		fmt.Println("Usage: md2nsx [options] <markdown_folder>")
-		fmt.Println("Options:")
-		fmt.Println("  -n, --notebook <name>  Set notebook name (default: \"Imported Notebook\")")
-		fmt.Println("Examples:")
-		fmt.Println("  md2nsx ./markdown-files")
-		fmt.Println("  md2nsx -n \"My Notes\" ./markdown-files")
-		fmt.Println("  md2nsx --notebook \"My Notes\" ./markdown-files")
-		fmt.Println("")
-		fmt.Println("Important: Flags must come BEFORE folder argument")
-		fmt.Println("  [OK] Correct: md2nsx --notebook \"Name\" ./folder")
-		fmt.Println("  [X]  Wrong:   md2nsx ./folder --notebook \"Name\"")
+	// Ctrl+C or SIGTERM cancel the running conversion, which then removes
+	// its partial output
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	if err := newRootCommand().ExecuteContext(ctx); err != nil {
+		// Errors are logged so they follow --log-format
+		logger.Error(err.Error())
 		os.Exit(1)
 	}
+}
 
-	markdownFolder := args[0]
+// parseSize parses a human readable size such as "512KB", "50MB" or "1GB".
+// Plain numbers are taken as bytes and an empty string means no limit.
+func parseSize(value string) (int64, error) {
+	value = strings.TrimSpace(strings.ToUpper(value))
+	if value == "" {
+		return 0, nil
+	}
 
-	// Validate input folder
-	if _, err := os.Stat(markdownFolder); os.IsNotExist(err) {
-		log.Fatalf("Error: Markdown folder '%s' does not exist", markdownFolder)
+	units := []struct {
+		suffix     string
+		multiplier int64
+	}{
+		{"GB", 1 << 30},
+		{"MB", 1 << 20},
+		{"KB", 1 << 10},
+		{"G", 1 << 30},
+		{"M", 1 << 20},
+		{"K", 1 << 10},
+		{"B", 1},
 	}
 
-	// Create converter instance
-	converter := NewNSXConverter()
+	multiplier := int64(1)
+	for _, unit := range units {
+		if strings.HasSuffix(value, unit.suffix) {
+			value = strings.TrimSpace(strings.TrimSuffix(value, unit.suffix))
+			multiplier = unit.multiplier
+			break
+		}
+	}
 
-	// Perform batch conversion
-	err := converter.BatchConvert(markdownFolder, notebookName)
+	size, err := strconv.ParseInt(value, 10, 64)
 	if err != nil {
-		log.Fatalf("Error during conversion: %v", err)
+		return 0, err
+	}
+	if size < 0 {
+		return 0, fmt.Errorf("size must not be negative")
 	}
 
-	fmt.Printf("Successfully converted markdown files in '%s' to NSX format\n", markdownFolder)
+	return size * multiplier, nil
 }
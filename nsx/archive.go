@@ -0,0 +1,206 @@
+package nsx
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"strings"
+)
+
+// archiveExtensions are the file name suffixes OpenArchive understands
+var archiveExtensions = []string{".zip", ".tar.gz", ".tgz", ".tar"}
+
+// IsArchive reports whether name looks like an archive OpenArchive can read,
+// judging by its extension
+func IsArchive(name string) bool {
+	return archiveExtension(name) != ""
+}
+
+// TrimArchiveExtension removes the archive extension from name, so
+// "docs-1.2.tar.gz" becomes "docs-1.2"
+func TrimArchiveExtension(name string) string {
+	return name[:len(name)-len(archiveExtension(name))]
+}
+
+// archiveExtension returns the archive extension of name, or "" if it has none
+func archiveExtension(name string) string {
+	lower := strings.ToLower(name)
+	for _, ext := range archiveExtensions {
+		if strings.HasSuffix(lower, ext) {
+			return ext
+		}
+	}
+	return ""
+}
+
+// ArchiveFS is a zip file or tarball opened as a read-only file system, so
+// its markdown files and attachments can be converted via Options.FS without
+// extracting them to disk. A zip file is read in place; a tarball cannot be
+// read randomly and is held in memory.
+type ArchiveFS struct {
+	reader *zip.Reader
+	file   *os.File
+}
+
+// OpenArchive opens a .zip, .tar.gz, .tgz or .tar file. The caller must
+// Close it when done.
+func OpenArchive(archivePath string) (*ArchiveFS, error) {
+	file, err := os.Open(archivePath)
+	if err != nil {
+		return nil, err
+	}
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return nil, err
+	}
+
+	archive, err := NewArchive(file, info.Size(), archivePath, 0)
+	if err != nil {
+		file.Close()
+		return nil, err
+	}
+	if archiveExtension(archivePath) == ".zip" {
+		// The zip file is read in place until the archive is closed
+		archive.file = file
+	} else {
+		file.Close()
+	}
+	return archive, nil
+}
+
+// NewArchive reads an archive of size bytes from r, such as an uploaded
+// file. The format is told by the extension of name. A zip file keeps
+// reading from r, which must stay open while the archive is used. If the
+// unpacked files add up to more than maxSize bytes, NewArchive fails with
+// ErrArchiveTooLarge; 0 means no limit. Set it for untrusted archives, whose
+// content may be many times larger than the archive itself.
+func NewArchive(r io.ReaderAt, size int64, name string, maxSize int64) (*ArchiveFS, error) {
+	switch archiveExtension(name) {
+	case ".zip":
+		reader, err := zip.NewReader(r, size)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read zip file %s: %w", name, err)
+		}
+		// The zip reader fails on entries longer than their recorded size,
+		// so checking the recorded sizes is enough
+		if maxSize > 0 {
+			var total uint64
+			for _, file := range reader.File {
+				total += file.UncompressedSize64
+				if total > uint64(maxSize) {
+					return nil, fmt.Errorf("%w: %s unpacks to more than %d bytes", ErrArchiveTooLarge, name, maxSize)
+				}
+			}
+		}
+		return &ArchiveFS{reader: reader}, nil
+	case "":
+		return nil, fmt.Errorf("unsupported archive format: %s (use %s)", name, strings.Join(archiveExtensions, ", "))
+	}
+
+	var input io.Reader = io.NewSectionReader(r, 0, size)
+	if archiveExtension(name) != ".tar" {
+		gzipReader, err := gzip.NewReader(input)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read tarball %s: %w", name, err)
+		}
+		defer gzipReader.Close()
+		input = gzipReader
+	}
+	if maxSize > 0 {
+		input = &sizeLimitReader{r: input, remaining: maxSize}
+	}
+	reader, err := tarToZip(input)
+	if errors.Is(err, ErrArchiveTooLarge) {
+		return nil, fmt.Errorf("%w: %s unpacks to more than %d bytes", ErrArchiveTooLarge, name, maxSize)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read tarball %s: %w", name, err)
+	}
+	return &ArchiveFS{reader: reader}, nil
+}
+
+// sizeLimitReader fails with ErrArchiveTooLarge once more than remaining
+// bytes were read
+type sizeLimitReader struct {
+	r         io.Reader
+	remaining int64
+}
+
+// Read implements io.Reader
+func (l *sizeLimitReader) Read(p []byte) (int, error) {
+	n, err := l.r.Read(p)
+	l.remaining -= int64(n)
+	if l.remaining < 0 {
+		return n, ErrArchiveTooLarge
+	}
+	return n, err
+}
+
+// tarToZip repacks the regular files of a tar stream into an uncompressed
+// in-memory zip file, whose reader already implements fs.FS including the
+// directories implied by the file names
+func tarToZip(r io.Reader) (*zip.Reader, error) {
+	var buf bytes.Buffer
+	zipWriter := zip.NewWriter(&buf)
+
+	tarReader := tar.NewReader(r)
+	for {
+		header, err := tarReader.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		if header.Typeflag != tar.TypeReg {
+			continue
+		}
+
+		writer, err := zipWriter.CreateHeader(&zip.FileHeader{
+			Name:     header.Name,
+			Method:   zip.Store,
+			Modified: header.ModTime,
+		})
+		if err != nil {
+			return nil, err
+		}
+		if _, err := io.Copy(writer, tarReader); err != nil {
+			return nil, err
+		}
+	}
+	if err := zipWriter.Close(); err != nil {
+		return nil, err
+	}
+
+	return zip.NewReader(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+}
+
+// Open opens the named file in the archive
+func (a *ArchiveFS) Open(name string) (fs.File, error) {
+	return a.reader.Open(name)
+}
+
+// Root returns the folder holding the archive's content: its only top-level
+// folder, as in most release tarballs, or "." otherwise
+func (a *ArchiveFS) Root() string {
+	entries, err := fs.ReadDir(a, ".")
+	if err != nil || len(entries) != 1 || !entries[0].IsDir() {
+		return "."
+	}
+	return entries[0].Name()
+}
+
+// Close closes the archive file
+func (a *ArchiveFS) Close() error {
+	if a.file == nil {
+		return nil
+	}
+	return a.file.Close()
+}
@@ -0,0 +1,94 @@
+package nsx
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"io/fs"
+	"testing"
+)
+
+// archiveFiles are packed into the archives of the tests: a note and a large
+// but highly compressible attachment
+var archiveFiles = map[string][]byte{
+	"docs/intro.md":  []byte("# Intro\n"),
+	"docs/zeros.bin": make([]byte, 1<<20),
+}
+
+// zipArchive packs archiveFiles into a compressed zip file
+func zipArchive(t *testing.T) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	writer := zip.NewWriter(&buf)
+	for name, data := range archiveFiles {
+		file, err := writer.Create(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := file.Write(data); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := writer.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+// tarGzArchive packs archiveFiles into a gzipped tarball
+func tarGzArchive(t *testing.T) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	gzipWriter := gzip.NewWriter(&buf)
+	writer := tar.NewWriter(gzipWriter)
+	for name, data := range archiveFiles {
+		if err := writer.WriteHeader(&tar.Header{Name: name, Mode: 0644, Size: int64(len(data)), Typeflag: tar.TypeReg}); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := writer.Write(data); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := writer.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := gzipWriter.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func TestNewArchiveSizeLimit(t *testing.T) {
+	archives := map[string][]byte{
+		"docs.zip":    zipArchive(t),
+		"docs.tar.gz": tarGzArchive(t),
+	}
+	for name, data := range archives {
+		t.Run(name, func(t *testing.T) {
+			if len(data) > 64<<10 {
+				t.Fatalf("test archive is %d bytes, expected it to compress well", len(data))
+			}
+
+			_, err := NewArchive(bytes.NewReader(data), int64(len(data)), name, 512<<10)
+			if !errors.Is(err, ErrArchiveTooLarge) {
+				t.Errorf("NewArchive with a limit below the unpacked size: got %v, want ErrArchiveTooLarge", err)
+			}
+
+			for _, limit := range []int64{0, 2 << 20} {
+				archive, err := NewArchive(bytes.NewReader(data), int64(len(data)), name, limit)
+				if err != nil {
+					t.Fatalf("NewArchive with limit %d failed: %v", limit, err)
+				}
+				if root := archive.Root(); root != "docs" {
+					t.Errorf("Root() = %q, want docs", root)
+				}
+				content, err := fs.ReadFile(archive, "docs/zeros.bin")
+				if err != nil || len(content) != 1<<20 {
+					t.Errorf("reading docs/zeros.bin: got %d bytes, %v", len(content), err)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,237 @@
+package nsx
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+)
+
+// cacheVersion is part of every cache key. Bump it whenever the rendered
+// output changes so stale entries are never reused.
+const cacheVersion = "2"
+
+// noteCache keeps rendered notes keyed by the hash of their markdown source
+// and the converter settings that influence rendering. Entries are kept in
+// memory and, when a directory is configured, persisted across runs.
+type noteCache struct {
+	dir string
+
+	mu      sync.Mutex
+	entries map[string]*cacheEntry
+}
+
+// cacheEntry is a previously converted note
+type cacheEntry struct {
+	NoteID      string             `json:"note_id"`
+	Title       string             `json:"title"`
+	NoteData    []byte             `json:"note_data"`
+	Files       []storedFile       `json:"files"`
+	Links       []cachedLink       `json:"links"`
+	Warnings    []string           `json:"warnings"`
+	Attachments []AttachmentReport `json:"attachments"`
+}
+
+// cachedLink records how an attachment link resolved when the note was
+// rendered. The entry is only reused while every link still resolves to the
+// same, unmodified file.
+type cachedLink struct {
+	Link    string `json:"link"`
+	Path    string `json:"path"`
+	Size    int64  `json:"size"`
+	ModTime int64  `json:"mtime"`
+}
+
+// newNoteCache creates a cache. An empty dir keeps entries in memory only.
+func newNoteCache(dir string) *noteCache {
+	return &noteCache{
+		dir:     dir,
+		entries: make(map[string]*cacheEntry),
+	}
+}
+
+// cacheKey derives the cache key of a markdown file from its content and the
+// settings that affect its rendered note (notebook, timestamp, theme, tags,
+// markdown extensions, templates, filters with the files they run and
+// Options.CacheKey)
+func (c *conversion) cacheKey(mdFile, mdContent, notebookID string) string {
+	hash := sha256.New()
+	fmt.Fprintf(hash, "v%s\x00%s\x00%s\x00", cacheVersion, filepath.Clean(mdFile), notebookID)
+	if !c.Options.Timestamp.IsZero() {
+		fmt.Fprintf(hash, "%d", c.Options.Timestamp.Unix())
+	}
+	fmt.Fprintf(hash, "\x00%s\x00%q\x00%q", c.theme(), c.noteTags(mdFile), c.Options.DisableExtensions)
+	fmt.Fprintf(hash, "\x00%q\x00%q\x00%q", c.Options.Header, c.Options.Footer, c.templateCacheKey(mdFile))
+	fmt.Fprintf(hash, "\x00%q", c.Options.CacheKey)
+	for _, filter := range c.Options.Filters {
+		fmt.Fprintf(hash, "\x00%s\x00%q\x00%s", filter.stage(), filter.Command, filter.Dir)
+	}
+	fmt.Fprintf(hash, "\x00%s", c.filterKey)
+	hash.Write([]byte{0})
+	hash.Write([]byte(mdContent))
+	return hex.EncodeToString(hash.Sum(nil))
+}
+
+// Get returns the cached note for key if its attachments are unchanged
+func (nc *noteCache) Get(ctx context.Context, c *Converter, key, mdFile, mdContent string) (*cacheEntry, bool) {
+	nc.mu.Lock()
+	entry, ok := nc.entries[key]
+	nc.mu.Unlock()
+
+	if !ok && nc.dir != "" {
+		data, err := os.ReadFile(nc.path(key))
+		if err != nil {
+			return nil, false
+		}
+		entry = &cacheEntry{}
+		if err := json.Unmarshal(data, entry); err != nil {
+			c.logger().Warn("Ignoring corrupt cache entry", "path", nc.path(key), "error", err)
+			return nil, false
+		}
+	}
+	if entry == nil {
+		return nil, false
+	}
+
+	current := c.resolveLinks(ctx, mdFile, mdContent)
+	if len(current) != len(entry.Links) {
+		return nil, false
+	}
+	for i := range current {
+		if current[i] != entry.Links[i] {
+			return nil, false
+		}
+	}
+
+	nc.mu.Lock()
+	nc.entries[key] = entry
+	nc.mu.Unlock()
+
+	return entry, true
+}
+
+// Put stores a converted note along with the warnings raised while rendering
+// it, so a cache hit reports them again
+func (nc *noteCache) Put(ctx context.Context, c *Converter, key, mdFile, mdContent string, note convertedNote, warnings []string) {
+	entry := &cacheEntry{
+		NoteID:      note.noteID,
+		Title:       note.title,
+		NoteData:    note.noteData,
+		Files:       note.files,
+		Links:       c.resolveLinks(ctx, mdFile, mdContent),
+		Warnings:    warnings,
+		Attachments: note.attachments,
+	}
+
+	nc.mu.Lock()
+	nc.entries[key] = entry
+	nc.mu.Unlock()
+
+	if nc.dir == "" {
+		return
+	}
+	if err := nc.write(key, entry); err != nil {
+		c.logger().Warn("Could not write cache entry", "file", mdFile, "error", err)
+	}
+}
+
+// write persists an entry atomically so concurrent runs never see partial data
+func (nc *noteCache) write(key string, entry *cacheEntry) error {
+	data, err := json.Marshal(entry)
+	if err != nil {
+		return err
+	}
+
+	path := nc.path(key)
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+
+	tempFile, err := os.CreateTemp(filepath.Dir(path), key+"-*.tmp")
+	if err != nil {
+		return err
+	}
+	if _, err := tempFile.Write(data); err != nil {
+		_ = tempFile.Close()
+		_ = os.Remove(tempFile.Name())
+		return err
+	}
+	if err := tempFile.Close(); err != nil {
+		_ = os.Remove(tempFile.Name())
+		return err
+	}
+	return os.Rename(tempFile.Name(), path)
+}
+
+// path returns the file an entry is persisted to
+func (nc *noteCache) path(key string) string {
+	return filepath.Join(nc.dir, key[:2], key+".json")
+}
+
+// resolveLinks resolves every attachment link in the markdown the same way
+// processAttachments does and records the state of the files found
+func (c *Converter) resolveLinks(ctx context.Context, mdFile, mdContent string) []cachedLink {
+	links := make([]cachedLink, 0)
+
+	for _, match := range imagePattern.FindAllStringSubmatch(mdContent, -1) {
+		if len(match) >= 3 {
+			links = append(links, c.resolveLink(ctx, mdFile, match[2]))
+		}
+	}
+	for _, match := range linkPattern.FindAllStringSubmatch(mdContent, -1) {
+		if len(match) >= 4 {
+			links = append(links, c.resolveLink(ctx, mdFile, match[2]+"."+match[3]))
+		}
+	}
+
+	return links
+}
+
+// resolveLink records where a single link resolves to. Missing files are
+// recorded with a size of -1 so that adding them later invalidates the entry.
+func (c *Converter) resolveLink(ctx context.Context, mdFile, link string) cachedLink {
+	resolved := cachedLink{Link: link, Size: -1}
+
+	filePath, err := c.findFile(ctx, mdFile, link)
+	if err != nil {
+		return resolved
+	}
+	info, err := c.source().Stat(filePath)
+	if err != nil {
+		return resolved
+	}
+
+	resolved.Path = filePath
+	resolved.Size = info.Size()
+	resolved.ModTime = info.ModTime().UnixNano()
+	return resolved
+}
+
+// linkDirs returns the directories of every attachment referenced by a cached
+// note, so callers can watch them for changes
+func (nc *noteCache) linkDirs() []string {
+	nc.mu.Lock()
+	defer nc.mu.Unlock()
+
+	seen := make(map[string]bool)
+	dirs := make([]string, 0)
+	for _, entry := range nc.entries {
+		for _, link := range entry.Links {
+			if link.Path == "" {
+				continue
+			}
+			dir := filepath.Dir(link.Path)
+			if !seen[dir] {
+				seen[dir] = true
+				dirs = append(dirs, dir)
+			}
+		}
+	}
+	sort.Strings(dirs)
+	return dirs
+}
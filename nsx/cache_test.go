@@ -0,0 +1,257 @@
+package nsx
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+	"testing/fstest"
+	"time"
+
+	"github.com/yuin/goldmark"
+	"github.com/yuin/goldmark/extension"
+)
+
+// convertNotes converts the sources and returns the report and the HTML
+// content of every note in the archive, keyed by note ID
+func convertNotes(t *testing.T, converter *Converter, sources ...string) (*Report, map[string]string) {
+	t.Helper()
+	var buf bytes.Buffer
+	report, err := converter.Convert(context.Background(), sources, &buf)
+	if err != nil {
+		t.Fatalf("Convert failed: %v", err)
+	}
+
+	archive, err := zip.NewReader(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+	if err != nil {
+		t.Fatalf("archive is not a zip file: %v", err)
+	}
+	notes := make(map[string]string)
+	for _, file := range archive.File {
+		if !strings.HasPrefix(file.Name, "note_") {
+			continue
+		}
+		reader, err := file.Open()
+		if err != nil {
+			t.Fatal(err)
+		}
+		data, err := io.ReadAll(reader)
+		reader.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+		var note Note
+		if err := json.Unmarshal(data, &note); err != nil {
+			t.Fatalf("note %s is not valid JSON: %v", file.Name, err)
+		}
+		notes[file.Name] = note.Content
+	}
+	return report, notes
+}
+
+func TestCacheCustomMarkdown(t *testing.T) {
+	fsys := fstest.MapFS{"notes/a.md": {Data: []byte("~~gone~~\n")}}
+	converter := NewConverter(Options{
+		FS:          fsys,
+		Timestamp:   time.Unix(1, 0),
+		MemoryCache: true,
+		Markdown:    goldmark.New(),
+	})
+
+	_, notes := convertNotes(t, converter, "notes")
+	if content := notes["note_YQ=="]; strings.Contains(content, "<del>") {
+		t.Fatalf("plain goldmark rendered strikethrough: %s", content)
+	}
+
+	// A different goldmark instance must not reuse the notes rendered before
+	converter.Options.Markdown = goldmark.New(goldmark.WithExtensions(extension.Strikethrough))
+	report, notes := convertNotes(t, converter, "notes")
+	if content := notes["note_YQ=="]; !strings.Contains(content, "<del>gone</del>") {
+		t.Errorf("note rendered with the previous goldmark instance: %s", content)
+	}
+	if cached := report.Count(StatusCached); cached != 0 {
+		t.Errorf("%d notes were taken from the cache without a CacheKey", cached)
+	}
+
+	// With a CacheKey the caller vouches for the setup, so notes are cached
+	converter.Options.CacheKey = "strikethrough"
+	convertNotes(t, converter, "notes")
+	report, _ = convertNotes(t, converter, "notes")
+	if cached := report.Count(StatusCached); cached != 1 {
+		t.Errorf("%d notes were taken from the cache with a CacheKey, want 1", cached)
+	}
+}
+
+func TestCacheOnNote(t *testing.T) {
+	fsys := fstest.MapFS{"notes/a.md": {Data: []byte("# A\n")}}
+	suffix := "<p>first</p>"
+	converter := NewConverter(Options{
+		FS:          fsys,
+		Timestamp:   time.Unix(1, 0),
+		MemoryCache: true,
+		Hooks: Hooks{OnNote: func(source string, note *Note) error {
+			note.Content += suffix
+			return nil
+		}},
+	})
+
+	convertNotes(t, converter, "notes")
+	// A changed hook must not be served the notes made by the old one
+	suffix = "<p>second</p>"
+	report, notes := convertNotes(t, converter, "notes")
+	if content := notes["note_YQ=="]; !strings.Contains(content, "<p>second</p>") {
+		t.Errorf("note was changed by the previous hook: %s", content)
+	}
+	if cached := report.Count(StatusCached); cached != 0 {
+		t.Errorf("%d notes were taken from the cache without a CacheKey", cached)
+	}
+
+	converter.Options.CacheKey = "second"
+	convertNotes(t, converter, "notes")
+	report, _ = convertNotes(t, converter, "notes")
+	if cached := report.Count(StatusCached); cached != 1 {
+		t.Errorf("%d notes were taken from the cache with a CacheKey, want 1", cached)
+	}
+}
+
+func TestCacheFilterScript(t *testing.T) {
+	if _, err := exec.LookPath("sh"); err != nil {
+		t.Skip("sh is not available")
+	}
+	dir := t.TempDir()
+	script := filepath.Join(dir, "filter.sh")
+	writeScript := func(content string) {
+		t.Helper()
+		if err := os.WriteFile(script, []byte("cat >/dev/null\necho '{\"content\": \""+content+"\"}'\n"), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	writeScript("first")
+
+	converter := NewConverter(Options{
+		FS:          fstest.MapFS{"notes/a.md": {Data: []byte("# A\n")}},
+		Timestamp:   time.Unix(1, 0),
+		MemoryCache: true,
+		Filters:     []Filter{{Command: []string{"sh", "filter.sh"}, Dir: dir}},
+	})
+	convertNotes(t, converter, "notes")
+	report, _ := convertNotes(t, converter, "notes")
+	if cached := report.Count(StatusCached); cached != 1 {
+		t.Fatalf("%d notes were taken from the cache with an unchanged filter, want 1", cached)
+	}
+
+	// Editing the script must render the note again
+	writeScript("second")
+	report, notes := convertNotes(t, converter, "notes")
+	if content := notes["note_YQ=="]; !strings.Contains(content, "second") {
+		t.Errorf("note was made by the previous filter script: %s", content)
+	}
+	if cached := report.Count(StatusCached); cached != 0 {
+		t.Errorf("%d notes were taken from the cache after the filter script changed", cached)
+	}
+}
+
+func TestCacheTemplateInputs(t *testing.T) {
+	fsys := fstest.MapFS{"notes/a.md": {Data: []byte("Body\n"), ModTime: time.Unix(100, 0)}}
+	converter := NewConverter(Options{
+		FS:          fsys,
+		Timestamp:   time.Unix(1, 0),
+		MemoryCache: true,
+		Footer:      "Modified {{.Modified.Unix}}",
+	})
+
+	convertNotes(t, converter, "notes")
+	report, _ := convertNotes(t, converter, "notes")
+	if cached := report.Count(StatusCached); cached != 1 {
+		t.Fatalf("%d notes were taken from the cache, want 1", cached)
+	}
+
+	// Touching the file leaves the content alone but changes the footer
+	fsys["notes/a.md"].ModTime = time.Unix(200, 0)
+	report, notes := convertNotes(t, converter, "notes")
+	if cached := report.Count(StatusCached); cached != 0 {
+		t.Errorf("%d notes were taken from the cache after the file was touched", cached)
+	}
+	if content := notes["note_YQ=="]; !strings.Contains(content, "Modified 200") {
+		t.Errorf("footer shows the old modification time: %s", content)
+	}
+}
+
+func TestCacheTemplateWithoutTimestamp(t *testing.T) {
+	fsys := fstest.MapFS{"notes/a.md": {Data: []byte("Body\n"), ModTime: time.Unix(100, 0)}}
+	converter := NewConverter(Options{FS: fsys, MemoryCache: true, Header: "Title {{.Title}}"})
+
+	// Without a fixed timestamp every run has a new import time, which only
+	// matters to templates that show it
+	convertNotes(t, converter, "notes")
+	report, _ := convertNotes(t, converter, "notes")
+	if cached := report.Count(StatusCached); cached != 1 {
+		t.Errorf("%d notes were taken from the cache with a header not showing the import time, want 1", cached)
+	}
+
+	converter.Options.Header = "Imported {{.Imported.UnixNano}}"
+	convertNotes(t, converter, "notes")
+	report, _ = convertNotes(t, converter, "notes")
+	if cached := report.Count(StatusCached); cached != 0 {
+		t.Errorf("%d notes were taken from the cache with a header showing the import time", cached)
+	}
+}
+
+func TestCacheTemplateGitCommit(t *testing.T) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git is not installed")
+	}
+	dir := t.TempDir()
+	git := func(args ...string) {
+		t.Helper()
+		cmd := exec.Command("git", append([]string{"-C", dir, "-c", "user.name=test", "-c", "user.email=test@example.com"}, args...)...)
+		if output, err := cmd.CombinedOutput(); err != nil {
+			t.Fatalf("git %s failed: %v\n%s", strings.Join(args, " "), err, output)
+		}
+	}
+	mdFile := filepath.Join(dir, "a.md")
+	if err := os.WriteFile(mdFile, []byte("Body\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	git("init", "-q")
+	git("add", "a.md")
+	git("commit", "-q", "-m", "first")
+
+	converter := NewConverter(Options{
+		Timestamp:   time.Unix(1, 0),
+		MemoryCache: true,
+		Footer:      "Commit {{.GitCommit}}",
+	})
+	_, first := convertNotes(t, converter, dir)
+	info, err := os.Stat(mdFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	modified := info.ModTime()
+
+	// Changing the file and changing it back leaves the content as it was,
+	// but the last commit is a different one
+	for i, content := range []string{"Draft\n", "Body\n"} {
+		if err := os.WriteFile(mdFile, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+		git("commit", "-q", "-a", "-m", fmt.Sprintf("edit %d", i))
+	}
+	if err := os.Chtimes(mdFile, modified, modified); err != nil {
+		t.Fatal(err)
+	}
+	report, second := convertNotes(t, converter, dir)
+	if cached := report.Count(StatusCached); cached != 0 {
+		t.Errorf("%d notes were taken from the cache after a new commit", cached)
+	}
+	if first["note_YQ=="] == second["note_YQ=="] {
+		t.Errorf("footer still shows the old commit: %s", second["note_YQ=="])
+	}
+}
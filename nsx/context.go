@@ -0,0 +1,21 @@
+package nsx
+
+import (
+	"context"
+	"io"
+)
+
+// contextReader fails reads once its context is done, so copying a large
+// file stops promptly when the conversion is cancelled
+type contextReader struct {
+	ctx context.Context
+	r   io.Reader
+}
+
+// Read reads from the underlying reader unless the context is done
+func (cr *contextReader) Read(p []byte) (int, error) {
+	if err := cr.ctx.Err(); err != nil {
+		return 0, err
+	}
+	return cr.r.Read(p)
+}
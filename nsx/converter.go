@@ -0,0 +1,1215 @@
+package nsx
+
+import (
+	"bytes"
+	"context"
+	"crypto/md5"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"regexp"
+	"runtime"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+
+	"github.com/gabriel-vasile/mimetype"
+	"github.com/yuin/goldmark"
+	"github.com/yuin/goldmark/ast"
+	"github.com/yuin/goldmark/renderer"
+	"github.com/yuin/goldmark/util"
+)
+
+// Pre-compiled regex patterns for better performance
+var (
+	imagePattern = regexp.MustCompile(`!\[(.*?)\]\((.*?)(?:\s+"(.*?)")?\)`)
+	linkPattern  = regexp.MustCompile(`\[(.*?)\]\((.*?)\.(pdf|doc|docx|txt|zip|rar|md|csv|xls|xlsx)\)`)
+
+	checkboxPattern = regexp.MustCompile(`<input[^>]*type="checkbox"[^>]*>`)
+)
+
+// DefaultNotebook is the notebook name used when Options.Notebook is empty
+const DefaultNotebook = "Imported Notebook"
+
+// Converter converts markdown files into NSX archives. A Converter may run
+// several conversions at the same time, which share its cache.
+type Converter struct {
+	// Options may be changed between conversions, but not while one is running
+	Options Options
+
+	// cache holds previously rendered notes, nil when caching is disabled
+	cache *noteCache
+
+	// sources are the markdown files of the last conversion, guarded by mu
+	mu      sync.Mutex
+	sources []string
+}
+
+// conversion is the state of a single Convert or ConvertToFiles call, so
+// that conversions running at the same time do not share it
+type conversion struct {
+	*Converter
+
+	// root, timestamp, progress, markdown and templates are fixed for the
+	// duration of the conversion
+	root      string
+	timestamp time.Time
+	progress  *progressTracker
+	markdown  goldmark.Markdown
+	templates noteTemplates
+
+	// useCache is set when notes may be taken from and stored in the cache,
+	// and filterKey fingerprints the filter programs for the cache key
+	useCache  bool
+	filterKey string
+
+	// files is shared by all workers and guarded by filesMu
+	filesMu sync.Mutex
+	files   map[string]storedFile
+}
+
+// Options configures a Converter
+type Options struct {
+	// Notebook is the name of the notebook the notes are imported into
+	// (default DefaultNotebook)
+	Notebook string
+	// MaxNotesPerFile limits how many notes go into a single NSX file (0 means no limit)
+	MaxNotesPerFile int
+	// MaxBytesPerFile limits the uncompressed size of a single NSX file (0 means no limit)
+	MaxBytesPerFile int64
+	// Workers is the number of files converted concurrently (0 means one per CPU)
+	Workers int
+	// Timestamp is used for every note, attachment and archive entry. The zero
+	// value uses the time the conversion starts; a fixed value makes the output
+	// reproducible for identical input.
+	Timestamp time.Time
+	// CacheDir enables the conversion cache. Unchanged files reuse the note
+	// rendered by a previous run instead of being converted again.
+	CacheDir string
+	// MemoryCache keeps rendered notes in memory between conversions run by
+	// the same Converter, even without a CacheDir
+	MemoryCache bool
+	// Theme is the chroma style used for syntax highlighting (default "github")
+	Theme string
+	// DisableExtensions turns off built-in goldmark extensions by name, see
+	// BuiltinExtensions
+	DisableExtensions []string
+	// MarkdownExtensions are added to goldmark after the built-in extensions
+	MarkdownExtensions []goldmark.Extender
+	// NodeRenderers are added to goldmark's HTML renderer. For a node kind
+	// that already has a renderer, the renderer with the lowest priority
+	// value wins; the built-in code span and blockquote renderers use 100.
+	NodeRenderers []util.PrioritizedValue
+	// Markdown, if set, replaces the goldmark instance built from Theme and
+	// the options above. It is shared by all workers, so it must be safe
+	// for concurrent use as goldmark's own instances are.
+	Markdown goldmark.Markdown
+	// CacheKey identifies the goldmark setup made with MarkdownExtensions,
+	// NodeRenderers and Markdown and the changes made by Hooks.OnNote, which
+	// the cache cannot compare by itself. When any of them is set, notes are
+	// only cached if CacheKey is set too; change it whenever that setup or
+	// hook changes the notes.
+	CacheKey string
+	// Filters are external commands that transform every note, see Filter
+	Filters []Filter
+	// Header and Footer are text/template sources rendered with TemplateData
+	// and added before and after the markdown of every note
+	Header string
+	Footer string
+	// Tags are added to every note
+	Tags []string
+	// TagRules add tags to the notes whose path matches a pattern
+	TagRules []TagRule
+	// AssetRoots are extra directories searched for attachments that are not
+	// found next to the markdown file
+	AssetRoots []string
+	// FS is the file system markdown files, attachments and .nsxignore files
+	// are read from; sources and AssetRoots are then paths within FS. Nil
+	// means the operating system's file system. Output files and the cache
+	// are always on the operating system's file system.
+	FS fs.FS
+	// Force allows ConvertToFiles to overwrite existing output files
+	Force bool
+	// Recursive also discovers markdown files in subfolders
+	Recursive bool
+	// Include limits discovery to markdown files matching one of these
+	// patterns. Include, Exclude and TagRules patterns use .nsxignore syntax
+	// and are matched against the path relative to the markdown folder.
+	Include []string
+	// Exclude lists patterns of markdown files and folders to skip
+	Exclude []string
+	// DryRun discovers, resolves and renders everything but writes no archive
+	DryRun bool
+	// Strict makes a conversion return an error if any markdown file failed
+	// to convert. The archive and report are still produced.
+	Strict bool
+	// Logger receives progress, warning and error messages (default: discard)
+	Logger *slog.Logger
+	// Progress, if set, is called whenever a file is done, an attachment is
+	// processed or data is written. It may be called from several goroutines.
+	Progress func(Progress)
+	// Hooks are called while converting, to adjust notes or collect metrics
+	Hooks Hooks
+}
+
+// TagRule adds Tags to every note whose path, relative to the markdown
+// folder and using forward slashes, matches Pattern (.nsxignore syntax)
+type TagRule struct {
+	Pattern string   `yaml:"pattern" toml:"pattern"`
+	Tags    []string `yaml:"tags" toml:"tags"`
+}
+
+// Attachment represents a file attachment
+type Attachment struct {
+	MD5    string `json:"md5"`
+	Name   string `json:"name"`
+	Size   int64  `json:"size"`
+	Width  int    `json:"width"`
+	Height int    `json:"height"`
+	Type   string `json:"type"`
+	CTime  int64  `json:"ctime"`
+	Ref    string `json:"ref"`
+}
+
+// Note represents a note in NSX format
+type Note struct {
+	Category   string                `json:"category"`
+	ParentID   string                `json:"parent_id"`
+	Title      string                `json:"title"`
+	Thumb      *string               `json:"thumb,omitempty"`
+	MTime      int64                 `json:"mtime"`
+	CTime      int64                 `json:"ctime"`
+	Latitude   float64               `json:"latitude"`
+	Longitude  float64               `json:"longitude"`
+	Encrypt    bool                  `json:"encrypt"`
+	Attachment map[string]Attachment `json:"attachment"`
+	Brief      string                `json:"brief"`
+	Content    string                `json:"content"`
+	Tag        []string              `json:"tag"`
+}
+
+// Notebook represents a notebook in NSX format
+type Notebook struct {
+	Category string `json:"category"`
+	ParentID string `json:"parent_id"`
+	Title    string `json:"title"`
+}
+
+// NotebookConfig represents the notebook configuration
+type NotebookConfig struct {
+	Note     []string `json:"note"`
+	Notebook []string `json:"notebook"`
+}
+
+// NewConverter creates a new converter
+func NewConverter(options Options) *Converter {
+	c := &Converter{Options: options}
+	if options.CacheDir != "" || options.MemoryCache {
+		c.cache = newNoteCache(options.CacheDir)
+	}
+	return c
+}
+
+// Convert converts the sources into a single NSX archive written to w.
+// Sources are markdown files or folders; folders are searched using the
+// discovery options. An archive written to w cannot be split, so exceeding
+// MaxNotesPerFile or MaxBytesPerFile fails with ErrCannotSplit. The report
+// describes every source file and is returned even when the conversion
+// fails part way through. When ctx is cancelled the conversion stops as soon
+// as possible and returns the context's error; data already written to w is
+// not taken back.
+func (c *Converter) Convert(ctx context.Context, sources []string, w io.Writer) (report *Report, err error) {
+	defer func() { c.Options.Hooks.complete(report, err) }()
+
+	run := c.newConversion()
+	mdFiles, skipped, err := run.collect(ctx, sources)
+	if err != nil {
+		return nil, err
+	}
+
+	report, err = run.convert(ctx, mdFiles, w, "")
+	if report != nil {
+		report.Files = append(report.Files, skipped...)
+	}
+	return report, err
+}
+
+// ConvertToFiles converts the sources into the NSX file at outputPath. When
+// a split limit is exceeded the archive is split into "name-1.nsx",
+// "name-2.nsx", ... Every file is written to a temporary file and only moved
+// into place once complete, so a failed or cancelled conversion leaves no
+// partial output behind. Existing files are only replaced with Force.
+func (c *Converter) ConvertToFiles(ctx context.Context, sources []string, outputPath string) (report *Report, err error) {
+	defer func() { c.Options.Hooks.complete(report, err) }()
+
+	if !c.Options.Force && !c.Options.DryRun {
+		if _, err := os.Stat(outputPath); err == nil {
+			return nil, fmt.Errorf("%w: %s", ErrOutputExists, outputPath)
+		}
+	}
+
+	run := c.newConversion()
+	mdFiles, skipped, err := run.collect(ctx, sources)
+	if err != nil {
+		return nil, err
+	}
+
+	report, err = run.convert(ctx, mdFiles, nil, outputPath)
+	if report != nil {
+		report.Files = append(report.Files, skipped...)
+	}
+	return report, err
+}
+
+// WatchDirs returns the directories a watcher should observe to notice
+// changes affecting the last conversion: the folders of the markdown files
+// and, when caching, of every attachment they referenced
+func (c *Converter) WatchDirs() []string {
+	c.mu.Lock()
+	sources := c.sources
+	c.mu.Unlock()
+
+	dirs := make([]string, 0)
+	for _, source := range sources {
+		dirs = append(dirs, filepath.Dir(source))
+	}
+	if c.cache != nil {
+		dirs = append(dirs, c.cache.linkDirs()...)
+	}
+	return dirs
+}
+
+// newConversion starts the state of a single conversion
+func (c *Converter) newConversion() *conversion {
+	return &conversion{
+		Converter: c,
+		useCache:  c.cache != nil && (c.Options.CacheKey != "" || !c.customNotes()),
+		files:     make(map[string]storedFile),
+	}
+}
+
+// customNotes reports whether goldmark or the OnNote hook customize notes in
+// ways the cache key cannot capture without a CacheKey
+func (c *Converter) customNotes() bool {
+	return len(c.Options.MarkdownExtensions) > 0 || len(c.Options.NodeRenderers) > 0 || c.Options.Markdown != nil || c.Options.Hooks.OnNote != nil
+}
+
+// collect resolves the sources into markdown files. Folders are searched
+// with discoverFiles, and the files they skip are returned as reports. A
+// single folder is the root that tag rules are matched against; otherwise
+// it is the common directory of all files. A file given more than once, or
+// also found in a folder, is converted once.
+func (c *conversion) collect(ctx context.Context, sources []string) ([]string, []FileReport, error) {
+	if err := c.checkPatterns(); err != nil {
+		return nil, nil, err
+	}
+
+	mdFiles := make([]string, 0)
+	skipped := make([]FileReport, 0)
+	seen := make(map[string]bool)
+	add := func(files ...string) {
+		for _, file := range files {
+			if key := filepath.Clean(file); !seen[key] {
+				seen[key] = true
+				mdFiles = append(mdFiles, file)
+			}
+		}
+	}
+	folders := 0
+	root := ""
+	for _, source := range sources {
+		info, err := c.source().Stat(source)
+		if err != nil {
+			return nil, nil, err
+		}
+		if !info.IsDir() {
+			add(source)
+			continue
+		}
+
+		// Walked paths are clean, so the folder must be too for the walk to
+		// recognise it as the root
+		folders++
+		root = filepath.Clean(source)
+		found, skippedHere, err := c.discoverFiles(ctx, root)
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to find markdown files: %w", err)
+		}
+		add(found...)
+		skipped = append(skipped, skippedHere...)
+	}
+
+	if len(mdFiles) == 0 {
+		return nil, nil, fmt.Errorf("%w in %s", ErrNoMarkdownFiles, strings.Join(sources, ", "))
+	}
+
+	if len(sources) == 1 && folders == 1 {
+		c.root = root
+	} else {
+		c.root = CommonDir(mdFiles)
+	}
+	return mdFiles, skipped, nil
+}
+
+// convert converts mdFiles into an archive streamed to stream or, if stream
+// is nil, into the NSX file(s) at outputPath. The report is returned even
+// when packaging fails part way through.
+func (c *conversion) convert(ctx context.Context, mdFiles []string, stream io.Writer, outputPath string) (*Report, error) {
+	logger := c.logger()
+	logger.Info("Found markdown files to convert", "count", len(mdFiles))
+	c.Converter.mu.Lock()
+	c.Converter.sources = mdFiles
+	c.Converter.mu.Unlock()
+	if c.cache != nil && !c.useCache {
+		logger.Warn("Not caching notes: custom goldmark extensions, renderers or instance and OnNote hooks need Options.CacheKey")
+	}
+
+	// Use a single timestamp for the whole run
+	c.timestamp = c.Options.Timestamp
+	if c.timestamp.IsZero() {
+		c.timestamp = time.Now()
+	}
+
+	// Generate notebook ID
+	notebookName := c.notebook()
+	notebookID := "nb_" + c.generateMD5Hash(notebookName)
+	logger.Info("Using notebook ID", "id", notebookID)
+
+	markdown, err := c.newMarkdown()
+	if err != nil {
+		return nil, err
+	}
+	if err := c.checkFilters(); err != nil {
+		return nil, err
+	}
+	if c.useCache {
+		c.filterKey = c.filterFingerprint()
+	}
+	if c.templates, err = c.parseTemplates(); err != nil {
+		return nil, err
+	}
+	c.markdown = markdown
+
+	report := &Report{
+		Notebook:   notebookName,
+		NotebookID: notebookID,
+		DryRun:     c.Options.DryRun,
+		Outputs:    make([]string, 0),
+		Files:      make([]FileReport, 0, len(mdFiles)),
+	}
+
+	// Notes and attachments are streamed straight into the archive
+	c.progress = newProgressTracker(len(mdFiles), c.Options.Progress)
+	writer := newNSXWriter(stream, outputPath, notebookName, notebookID, c.timestamp, c.Options, logger, c.progress, c.source())
+	defer writer.Abort()
+	if c.Options.DryRun {
+		logger.Info("Dry run, nothing will be written", "output", writer.name())
+	} else {
+		logger.Info("Packaging", "output", writer.name())
+	}
+
+	// Convert files concurrently, but add them to the archive in input order
+	results := c.convertAll(ctx, mdFiles, notebookID)
+	defer results.Stop()
+
+	cached := 0
+	failures := make([]error, 0)
+	noteIDs := make(map[string]bool)
+	for i, mdFile := range mdFiles {
+		var result convertedNote
+		select {
+		case result = <-results.At(i):
+		case <-ctx.Done():
+			return report, ctx.Err()
+		}
+		if err := ctx.Err(); err != nil {
+			return report, err
+		}
+		c.progress.FileDone()
+		file := newFileReport(mdFile, result)
+		if result.err != nil {
+			logger.Error("Failed to convert file", "file", mdFile, "error", result.err)
+			failures = append(failures, result.err)
+			report.Files = append(report.Files, file)
+			continue
+		}
+		if result.cached {
+			cached++
+		}
+
+		// Files with the same name in different directories need distinct IDs
+		noteID := result.noteID
+		if noteIDs[noteID] {
+			noteID = "note_" + base64.StdEncoding.EncodeToString([]byte(relativePath(c.root, mdFile)))
+			logger.Warn("Duplicate note title, using a path based ID", "file", mdFile, "note", noteID)
+			warning := fmt.Sprintf("duplicate note title, using ID %s", noteID)
+			file.Warnings = append(file.Warnings, warning)
+			c.Options.Hooks.warning(mdFile, warning)
+		}
+		noteIDs[noteID] = true
+
+		if err := writer.AddNote(ctx, noteID, result.noteData, result.files); err != nil {
+			return report, fmt.Errorf("failed to package NSX: %w", err)
+		}
+		file.NoteID = noteID
+		file.Part = writer.Part()
+		report.Files = append(report.Files, file)
+
+		logger.Debug("Converted", "file", mdFile, "note", noteID)
+	}
+
+	outputPaths, err := writer.Close()
+	if err != nil {
+		return report, fmt.Errorf("failed to package NSX: %w", err)
+	}
+	report.Outputs = outputPaths
+
+	if c.useCache {
+		logger.Info("Reused notes from cache", "cached", cached, "total", len(mdFiles))
+	}
+	converted := len(mdFiles) - len(failures)
+	if len(failures) > 0 {
+		logger.Warn("Some files failed to convert", "failed", len(failures), "total", len(mdFiles))
+	}
+	if c.Options.DryRun {
+		logger.Info("Dry run complete", "files", converted, "outputs", strings.Join(outputPaths, ", "))
+	} else {
+		logger.Info("Successfully converted files", "files", converted, "outputs", strings.Join(outputPaths, ", "))
+	}
+
+	if c.Options.Strict && len(failures) > 0 {
+		return report, errors.Join(failures...)
+	}
+	return report, nil
+}
+
+// notebook returns the name of the notebook to import into
+func (c *Converter) notebook() string {
+	if c.Options.Notebook == "" {
+		return DefaultNotebook
+	}
+	return c.Options.Notebook
+}
+
+// logger returns the logger messages are sent to
+func (c *Converter) logger() *slog.Logger {
+	if c.Options.Logger == nil {
+		return discardLogger
+	}
+	return c.Options.Logger
+}
+
+// convertedNote is the result of converting a single markdown file
+type convertedNote struct {
+	noteID      string
+	title       string
+	noteData    []byte
+	files       []storedFile
+	warnings    []string
+	attachments []AttachmentReport
+	cached      bool
+	err         error
+}
+
+// noteBuild collects what is gathered while converting a single markdown
+// file: the attachments it references, where they were found and the
+// warnings raised on the way
+type noteBuild struct {
+	mdFile      string
+	logger      *slog.Logger
+	hooks       *Hooks
+	attachments map[string]Attachment
+	sources     map[string]string
+	warnings    []string
+}
+
+// newNoteBuild creates an empty build for mdFile that logs warnings to logger
+// and passes them to the OnWarning hook
+func newNoteBuild(mdFile string, logger *slog.Logger, hooks *Hooks) *noteBuild {
+	return &noteBuild{
+		mdFile:      mdFile,
+		logger:      logger,
+		hooks:       hooks,
+		attachments: make(map[string]Attachment),
+		sources:     make(map[string]string),
+		warnings:    make([]string, 0),
+	}
+}
+
+// warn records a warning for the file and logs it
+func (b *noteBuild) warn(format string, args ...any) {
+	message := fmt.Sprintf(format, args...)
+	b.warnings = append(b.warnings, message)
+	b.logger.Warn(message, "file", b.mdFile)
+	b.hooks.warning(b.mdFile, message)
+}
+
+// attachmentReports lists the attachments of the note ordered by key
+func (b *noteBuild) attachmentReports() []AttachmentReport {
+	fileKeys := make([]string, 0, len(b.attachments))
+	for fileKey := range b.attachments {
+		fileKeys = append(fileKeys, fileKey)
+	}
+	sort.Strings(fileKeys)
+
+	reports := make([]AttachmentReport, 0, len(fileKeys))
+	for _, fileKey := range fileKeys {
+		reports = append(reports, b.attachmentReport(fileKey))
+	}
+	return reports
+}
+
+// attachmentReport describes a single attachment of the note
+func (b *noteBuild) attachmentReport(fileKey string) AttachmentReport {
+	attachment := b.attachments[fileKey]
+	return AttachmentReport{
+		Key:    fileKey,
+		Name:   attachment.Name,
+		Source: b.sources[fileKey],
+		Type:   attachment.Type,
+		Size:   attachment.Size,
+	}
+}
+
+// conversionResults delivers converted notes from the worker pool. Each input
+// file has its own single-slot channel so results can be consumed in order.
+type conversionResults struct {
+	slots []chan convertedNote
+	stop  chan struct{}
+	once  sync.Once
+}
+
+// At returns the channel that receives the result for the i-th input file
+func (r *conversionResults) At(i int) <-chan convertedNote {
+	return r.slots[i]
+}
+
+// Stop tells the pool not to start converting any further files
+func (r *conversionResults) Stop() {
+	r.once.Do(func() { close(r.stop) })
+}
+
+// convertAll converts the given files using a bounded pool of workers. No
+// further files are started once ctx is done.
+func (c *conversion) convertAll(ctx context.Context, mdFiles []string, notebookID string) *conversionResults {
+	workers := c.Options.Workers
+	if workers <= 0 {
+		workers = runtime.NumCPU()
+	}
+	if workers > len(mdFiles) {
+		workers = len(mdFiles)
+	}
+
+	results := &conversionResults{
+		slots: make([]chan convertedNote, len(mdFiles)),
+		stop:  make(chan struct{}),
+	}
+	for i := range results.slots {
+		results.slots[i] = make(chan convertedNote, 1)
+	}
+
+	jobs := make(chan int)
+	go func() {
+		defer close(jobs)
+		for i := range mdFiles {
+			select {
+			case jobs <- i:
+			case <-results.stop:
+				return
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	for w := 0; w < workers; w++ {
+		go func() {
+			for i := range jobs {
+				results.slots[i] <- c.convertFile(ctx, mdFiles[i], notebookID)
+			}
+		}()
+	}
+
+	return results
+}
+
+// convertFile converts a single markdown file into note JSON
+func (c *conversion) convertFile(ctx context.Context, mdFile, notebookID string) convertedNote {
+	c.logger().Debug("Converting", "file", mdFile)
+	build := newNoteBuild(mdFile, c.logger(), &c.Options.Hooks)
+
+	// Read markdown content
+	mdContent, err := c.readFileWithEncoding(ctx, mdFile, build)
+	if err != nil {
+		return convertedNote{warnings: build.warnings, err: &FileError{Op: "reading", Path: mdFile, Err: err}}
+	}
+	readWarnings := len(build.warnings)
+
+	// Reuse the previous result if neither the file nor its attachments changed
+	var cacheKey string
+	if c.useCache {
+		cacheKey = c.cacheKey(mdFile, mdContent, notebookID)
+		if entry, ok := c.cache.Get(ctx, c.Converter, cacheKey, mdFile, mdContent); ok {
+			for _, warning := range entry.Warnings {
+				build.warn("%s", warning)
+			}
+			for _, attachment := range entry.Attachments {
+				c.Options.Hooks.attachment(mdFile, attachment)
+			}
+			return convertedNote{
+				noteID:      entry.NoteID,
+				title:       entry.Title,
+				noteData:    entry.NoteData,
+				files:       entry.Files,
+				warnings:    build.warnings,
+				attachments: entry.Attachments,
+				cached:      true,
+			}
+		}
+	}
+
+	// Separate the front matter and let markdown filters transform the note
+	title := strings.TrimSuffix(filepath.Base(mdFile), ".md")
+	if title == "" {
+		title = "Untitled"
+	}
+	frontMatter, body, ok := splitFrontMatter(mdContent)
+	if !ok {
+		build.warn("front matter is not valid YAML, rendering it as markdown")
+	}
+	if frontMatter == nil {
+		frontMatter = make(map[string]any)
+	}
+	doc := &FilterDocument{
+		Source:      mdFile,
+		Title:       title,
+		Tags:        c.noteTags(mdFile),
+		FrontMatter: frontMatter,
+		Content:     body,
+	}
+	if err := c.runFilters(ctx, FilterStageMarkdown, doc, build); err != nil {
+		return convertedNote{warnings: build.warnings, err: &FileError{Op: "filtering", Path: mdFile, Err: err}}
+	}
+
+	if err := c.applyTemplates(doc); err != nil {
+		return convertedNote{warnings: build.warnings, err: &FileError{Op: "rendering templates for", Path: mdFile, Err: err}}
+	}
+
+	// Process images and attachments
+	processedContent, err := c.processAttachments(ctx, mdFile, doc.Content, build)
+	if err != nil {
+		return convertedNote{warnings: build.warnings, err: &FileError{Op: "processing attachments for", Path: mdFile, Err: err}}
+	}
+	attachments := build.attachmentReports()
+	for _, attachment := range attachments {
+		c.Options.Hooks.attachment(mdFile, attachment)
+	}
+
+	// Rendering cannot be interrupted, so check once more before starting
+	if err := ctx.Err(); err != nil {
+		return convertedNote{warnings: build.warnings, err: err}
+	}
+
+	// Create note object
+	note, titleBase64, err := c.createNote(doc.Title, processedContent, notebookID, build.attachments, doc.Tags)
+	if err != nil {
+		return convertedNote{warnings: build.warnings, err: &FileError{Op: "creating note for", Path: mdFile, Err: err}}
+	}
+
+	// HTML filters see the rendered note
+	doc.Content = note.Content
+	if err := c.runFilters(ctx, FilterStageHTML, doc, build); err != nil {
+		return convertedNote{warnings: build.warnings, err: &FileError{Op: "filtering", Path: mdFile, Err: err}}
+	}
+	note.Title, note.Tag, note.Content = doc.Title, doc.Tags, doc.Content
+
+	if err := c.Options.Hooks.note(mdFile, note); err != nil {
+		return convertedNote{warnings: build.warnings, err: &FileError{Op: "running note hook for", Path: mdFile, Err: err}}
+	}
+
+	noteData, err := json.MarshalIndent(note, "", "  ")
+	if err != nil {
+		return convertedNote{warnings: build.warnings, err: &FileError{Op: "marshaling note", Path: mdFile, Err: err}}
+	}
+
+	result := convertedNote{
+		noteID:      "note_" + titleBase64,
+		title:       note.Title,
+		noteData:    noteData,
+		files:       c.noteFiles(note),
+		warnings:    build.warnings,
+		attachments: attachments,
+	}
+	if c.useCache {
+		// Warnings about reading the file are raised again on every run
+		c.cache.Put(ctx, c.Converter, cacheKey, mdFile, mdContent, result, build.warnings[readWarnings:])
+	}
+	return result
+}
+
+// CommonDir returns the deepest directory containing every file. When
+// converting a list of files, tag rules are matched against paths relative
+// to it.
+func CommonDir(files []string) string {
+	dir := filepath.Dir(filepath.Clean(files[0]))
+	for _, file := range files[1:] {
+		fileDir := filepath.Dir(filepath.Clean(file))
+		for dir != "." && dir != string(filepath.Separator) && fileDir != dir && !strings.HasPrefix(fileDir, dir+string(filepath.Separator)) {
+			dir = filepath.Dir(dir)
+		}
+	}
+	return dir
+}
+
+// relativePath returns the path of filePath relative to root, using forward
+// slashes
+func relativePath(root, filePath string) string {
+	rel, err := filepath.Rel(root, filePath)
+	if err != nil {
+		return filepath.ToSlash(filePath)
+	}
+	return filepath.ToSlash(rel)
+}
+
+// noteTags returns the tags for a note: the global tags followed by the tags
+// of every matching rule, without duplicates
+func (c *conversion) noteTags(mdFile string) []string {
+	tags := make([]string, 0)
+	seen := make(map[string]bool)
+	add := func(values []string) {
+		for _, tag := range values {
+			if tag != "" && !seen[tag] {
+				seen[tag] = true
+				tags = append(tags, tag)
+			}
+		}
+	}
+
+	add(c.Options.Tags)
+	rel := relativePath(c.root, mdFile)
+	for _, rule := range c.Options.TagRules {
+		if matchesAny([]string{rule.Pattern}, rel) {
+			add(rule.Tags)
+		}
+	}
+	return tags
+}
+
+// theme returns the syntax highlighting style to use
+func (c *Converter) theme() string {
+	if c.Options.Theme == "" {
+		return "github"
+	}
+	return c.Options.Theme
+}
+
+// readFileWithEncoding reads a file with UTF-8 encoding
+func (c *Converter) readFileWithEncoding(ctx context.Context, filePath string, build *noteBuild) (string, error) {
+	data, err := c.source().ReadFile(ctx, filePath)
+	if err != nil {
+		return "", err
+	}
+
+	// Check if it's valid UTF-8
+	if !isValidUTF8(data) {
+		build.warn("File %s may contain non-UTF-8 characters", filePath)
+	}
+
+	return string(data), nil
+}
+
+// isValidUTF8 checks if the data is valid UTF-8
+func isValidUTF8(data []byte) bool {
+	return utf8.Valid(data)
+}
+
+// processAttachments processes images and file attachments in markdown content
+// and returns the rewritten content. The attachments it references are
+// collected in build. Attachments that cannot be processed are reported as
+// warnings; only cancellation of ctx fails the whole file.
+func (c *conversion) processAttachments(ctx context.Context, mdFile, mdContent string, build *noteBuild) (string, error) {
+	// Process image links - support both basic and title formats
+	imageMatches := imagePattern.FindAllStringSubmatch(mdContent, -1)
+
+	// Process file links
+	linkMatches := linkPattern.FindAllStringSubmatch(mdContent, -1)
+
+	// Process all matches
+	for _, match := range imageMatches {
+		if len(match) >= 3 {
+			altText, link := match[1], match[2]
+			// Use title as alt text if available, otherwise use alt text
+			if len(match) >= 4 && match[3] != "" {
+				altText = match[3]
+			}
+			if err := c.processAttachment(ctx, mdFile, "image", altText, link, &mdContent, build); err != nil {
+				if ctx.Err() != nil {
+					return "", ctx.Err()
+				}
+				build.warn("Failed to process image %s: %v", link, err)
+			}
+		}
+	}
+
+	for _, match := range linkMatches {
+		if len(match) >= 4 {
+			text, link, ext := match[1], match[2], match[3]
+			fullLink := link + "." + ext
+			if err := c.processAttachment(ctx, mdFile, "link", text, fullLink, &mdContent, build); err != nil {
+				if ctx.Err() != nil {
+					return "", ctx.Err()
+				}
+				build.warn("Failed to process link %s: %v", fullLink, err)
+			}
+		}
+	}
+
+	return mdContent, nil
+}
+
+// processAttachment processes a single attachment
+func (c *conversion) processAttachment(ctx context.Context, mdFile, matchType, altText, link string, mdContent *string, build *noteBuild) error {
+	// Find the file
+	filePath, err := c.findFile(ctx, mdFile, link)
+	if err != nil {
+		return err
+	}
+
+	// Read file data
+	fileData, err := c.source().ReadFile(ctx, filePath)
+	if err != nil {
+		return fmt.Errorf("failed to read file %s: %w", filePath, err)
+	}
+
+	// Calculate MD5 hash
+	md5Hash := c.generateMD5Hash(string(fileData))
+
+	// Detect MIME type
+	mimeType := mimetype.Detect(fileData).String()
+
+	isImage := false
+	switch matchType {
+	case "image":
+		isImage = true
+	case "link":
+		isImage = strings.HasPrefix(mimeType, "image/")
+	}
+
+	width, height := 0, 0
+	if isImage {
+		width, height = 400, 300
+	}
+
+	timestamp := c.timestamp.Unix()
+
+	originalFilename := filepath.Base(filePath)
+	filenameWithTimestamp := fmt.Sprintf("%s%d", originalFilename, timestamp)
+	filenameB64 := base64.StdEncoding.EncodeToString([]byte(filenameWithTimestamp))
+	fileKey := "file_" + filenameB64
+
+	refContent := fmt.Sprintf("%d%s", timestamp, originalFilename)
+	refB64 := base64.StdEncoding.EncodeToString([]byte(refContent))
+
+	var htmlTag, originalMD string
+	if isImage {
+		htmlTag = fmt.Sprintf(`<img class="syno-notestation-image-object" src="webman/3rdparty/NoteStation/images/transparent.gif" border="0" width="%d" ref="%s" adjust="true"/>`, width, refB64)
+		originalMD = fmt.Sprintf("![%s](%s)", altText, link)
+	} else {
+		displayText := altText
+		if displayText == "" {
+			switch matchType {
+			case "link":
+				displayText = "Attachment"
+			default:
+				displayText = "File"
+			}
+		}
+		htmlTag = fmt.Sprintf(`<a href="%s" target="_blank">%s</a>`, refB64, displayText)
+		originalMD = fmt.Sprintf("[%s](%s)", altText, link)
+	}
+
+	*mdContent = strings.ReplaceAll(*mdContent, originalMD, htmlTag)
+
+	build.sources[fileKey] = filePath
+	build.attachments[fileKey] = Attachment{
+		MD5:    md5Hash,
+		Name:   originalFilename,
+		Size:   int64(len(fileData)),
+		Width:  width,
+		Height: height,
+		Type:   mimeType,
+		CTime:  timestamp,
+		Ref:    refB64,
+	}
+
+	if isImage {
+		c.filesMu.Lock()
+		c.files[md5Hash] = storedFile{
+			MD5Hash: md5Hash,
+			Path:    filePath,
+			Size:    int64(len(fileData)),
+		}
+		c.filesMu.Unlock()
+	}
+
+	c.progress.AttachmentDone()
+	c.logger().Debug("Processed attachment", "type", matchType, "path", filePath, "key", fileKey, "mime", mimeType)
+	return nil
+}
+
+// findFile searches for a file in the current directory, the markdown file's
+// directory and then the configured asset roots. The search stops with the
+// context's error when ctx is done.
+func (c *Converter) findFile(ctx context.Context, mdFile, link string) (string, error) {
+	source := c.source()
+
+	// Check if file exists in current directory
+	if _, err := source.Stat(link); err == nil {
+		return link, nil
+	}
+
+	// Search in parent directory, then in the asset roots
+	searchDirs := append([]string{filepath.Dir(mdFile)}, c.Options.AssetRoots...)
+	for _, dir := range searchDirs {
+		found := ""
+		err := source.WalkDir(dir, func(walkPath string, entry fs.DirEntry, err error) error {
+			if err != nil {
+				return err
+			}
+			if err := ctx.Err(); err != nil {
+				return err
+			}
+			if !entry.IsDir() && strings.Contains(filepath.Base(walkPath), filepath.Base(link)) {
+				found = walkPath
+				return filepath.SkipAll
+			}
+			return nil
+		})
+
+		if ctxErr := ctx.Err(); ctxErr != nil {
+			return "", ctxErr
+		}
+		if err != nil && err != filepath.SkipAll {
+			continue
+		}
+		if found != "" {
+			return found, nil
+		}
+	}
+
+	return "", fmt.Errorf("file not found: %s", link)
+}
+
+type customCodeSpanRenderer struct{}
+
+func (r *customCodeSpanRenderer) RegisterFuncs(reg renderer.NodeRendererFuncRegisterer) {
+	reg.Register(ast.KindCodeSpan, r.renderCodeSpan)
+}
+
+func (r *customCodeSpanRenderer) renderCodeSpan(w util.BufWriter, source []byte, n ast.Node, entering bool) (ast.WalkStatus, error) {
+	if entering {
+		_, _ = w.WriteString(`<code 123 style="color: #e83e8c; background-color: #f8f9fa; padding: 2px 4px; border-radius: 3px;">`)
+		for c := n.FirstChild(); c != nil; c = c.NextSibling() {
+			segment := c.(*ast.Text).Segment
+			value := segment.Value(source)
+			if bytes.HasSuffix(value, []byte("\n")) {
+				_, _ = w.Write(value[:len(value)-1])
+				_, _ = w.Write([]byte(" "))
+			} else {
+				_, _ = w.Write(value)
+			}
+		}
+		return ast.WalkSkipChildren, nil
+	}
+	_, _ = w.WriteString("</code>")
+	return ast.WalkContinue, nil
+}
+
+type customCodeBlockPreWrapper struct{}
+
+func (r *customCodeBlockPreWrapper) Start(code bool, styleAttr string) string {
+	return `<code style="white-space: pre; font-family: Menlo, Monaco, Consolas, monospace; display: inline-block;">`
+}
+
+func (r *customCodeBlockPreWrapper) End(code bool) string {
+	return `</code>`
+}
+
+type customBlockquoteRenderer struct{}
+
+func (r *customBlockquoteRenderer) RegisterFuncs(reg renderer.NodeRendererFuncRegisterer) {
+	reg.Register(ast.KindBlockquote, r.renderBlockquote)
+}
+
+func (r *customBlockquoteRenderer) renderBlockquote(w util.BufWriter, source []byte, node ast.Node, entering bool) (ast.WalkStatus, error) {
+	if entering {
+		_, _ = w.WriteString(`<blockquote style="margin: 1em 0; padding: 0.5em 1em; border-left: 4px solid #ccc; color: #666;">`)
+	} else {
+		_, _ = w.WriteString("</blockquote>")
+	}
+	return ast.WalkContinue, nil
+}
+
+var (
+	styleCodeBlock = `
+	background-color: #f6f8fa !important;border: 1px solid #d1d5da;padding: 16px;
+	margin: 10px 0;border-radius: 12px;box-shadow: 0 1px 3px rgba(0,0,0,0.12), 0 1px 2px rgba(0,0,0,0.24);
+	display:inline-block; overflow-x: auto;max-width: 100%;min-width: 60%;
+	`
+)
+
+// markdownToHTML converts markdown content to HTML using the goldmark
+// instance of the current run
+func (c *conversion) markdownToHTML(_, mdContent string) (string, error) {
+	var buf bytes.Buffer
+	if err := c.markdown.Convert([]byte(mdContent), &buf); err != nil {
+		return "", err
+	}
+	htmlContent := buf.String()
+	htmlContent = c.processTodoLists(htmlContent)
+
+	return htmlContent, nil
+}
+
+var (
+	htmlCheckboxChecked = `<input class="syno-notestation-editor-checkbox syno-notestation-editor-checkbox-checked note-station-checkbox-checked" ` +
+		`src="webman/3rdparty/NoteStation/images/transparent.gif" type="image" data-mce-contenteditable="false" />`
+
+	htmlCheckboxUnchecked = `<input class="syno-notestation-editor-checkbox note-station-checkbox" src="webman/3rdparty/NoteStation/images/transparent.gif" type="image" />`
+)
+
+// processTodoLists converts markdown todo lists to Note Station format
+func (c *Converter) processTodoLists(htmlContent string) string {
+	matches := checkboxPattern.FindAllString(htmlContent, -1)
+	for _, match := range matches {
+		if strings.Contains(match, `checked=""`) {
+			// checked
+			htmlContent = strings.ReplaceAll(htmlContent, match, htmlCheckboxChecked)
+		} else {
+			// unchecked
+			htmlContent = strings.ReplaceAll(htmlContent, match, htmlCheckboxUnchecked)
+		}
+	}
+	return htmlContent
+}
+
+// createNote creates a note object
+func (c *conversion) createNote(title, markdownContent, parentID string, attachments map[string]Attachment, tags []string) (*Note, string, error) {
+	// Base64 encode title
+	titleBase64 := base64.StdEncoding.EncodeToString([]byte(title))
+
+	// Ensure content is not empty
+	if strings.TrimSpace(markdownContent) == "" {
+		markdownContent = "Empty note"
+	}
+
+	// Generate timestamp
+	currentTime := c.timestamp.Unix()
+
+	// Find thumbnail, checking attachments in a stable order
+	fileKeys := make([]string, 0, len(attachments))
+	for fileKey := range attachments {
+		fileKeys = append(fileKeys, fileKey)
+	}
+	sort.Strings(fileKeys)
+
+	var thumb *string
+	for _, fileKey := range fileKeys {
+		if strings.HasPrefix(attachments[fileKey].Type, "image/") {
+			thumb = &fileKey
+			break
+		}
+	}
+
+	// Generate brief from original markdown content (before HTML conversion)
+	brief := c.generateBriefFromMarkdown(markdownContent)
+
+	// Convert markdown to HTML for the content
+	htmlContent, err := c.markdownToHTML(title, markdownContent)
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to convert markdown to HTML: %w", err)
+	}
+
+	note := &Note{
+		Category:   "note",
+		ParentID:   parentID,
+		Title:      title,
+		Thumb:      thumb,
+		MTime:      currentTime,
+		CTime:      currentTime,
+		Latitude:   0,
+		Longitude:  0,
+		Encrypt:    false,
+		Attachment: attachments,
+		Brief:      brief,
+		Content:    htmlContent,
+		Tag:        tags,
+	}
+
+	return note, titleBase64, nil
+}
+
+// generateBriefFromMarkdown generates a clean brief from markdown content
+func (c *Converter) generateBriefFromMarkdown(markdownContent string) string {
+	plainText := c.cleanBrief(markdownContent)
+
+	// Limit to 100 characters
+	if len(plainText) > 100 {
+		plainText = plainText[:100] + "..."
+	}
+
+	return plainText
+}
+
+// cleanBrief cleans up brief text
+func (c *Converter) cleanBrief(brief string) string {
+	// Replace all whitespace characters with single spaces
+	replacer := strings.NewReplacer(
+		"\n", " ",
+		"\r", " ",
+		"\t", " ",
+	)
+	brief = replacer.Replace(brief)
+
+	// Remove multiple consecutive spaces
+	for strings.Contains(brief, "  ") {
+		brief = strings.ReplaceAll(brief, "  ", " ")
+	}
+
+	return strings.TrimSpace(brief)
+}
+
+// noteFiles returns the stored files a note's attachments need in the archive,
+// ordered by attachment key
+func (c *conversion) noteFiles(note *Note) []storedFile {
+	fileKeys := make([]string, 0, len(note.Attachment))
+	for fileKey := range note.Attachment {
+		fileKeys = append(fileKeys, fileKey)
+	}
+	sort.Strings(fileKeys)
+
+	c.filesMu.Lock()
+	defer c.filesMu.Unlock()
+
+	files := make([]storedFile, 0)
+	for _, fileKey := range fileKeys {
+		if file, ok := c.files[note.Attachment[fileKey].MD5]; ok {
+			files = append(files, file)
+		}
+	}
+	return files
+}
+
+// generateMD5Hash generates MD5 hash of a string
+func (c *Converter) generateMD5Hash(input string) string {
+	hash := md5.Sum([]byte(input))
+	return fmt.Sprintf("%x", hash)
+}
@@ -0,0 +1,106 @@
+package nsx
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"sync"
+	"testing"
+	"testing/fstest"
+	"time"
+)
+
+// testFS returns a small markdown tree for conversions from Options.FS
+func testFS() fstest.MapFS {
+	return fstest.MapFS{
+		"docs/intro.md":       {Data: []byte("# Intro\n\nSee [the guide](guide.md).\n")},
+		"docs/guide.md":       {Data: []byte("# Guide\n\n- [ ] first\n- [x] second\n")},
+		"docs/notes/extra.md": {Data: []byte("Extra\n")},
+	}
+}
+
+func TestConverterConcurrentConvert(t *testing.T) {
+	converter := NewConverter(Options{
+		FS:          testFS(),
+		Timestamp:   time.Unix(1, 0),
+		Recursive:   true,
+		MemoryCache: true,
+	})
+
+	const runs = 4
+	outputs := make([][]byte, runs)
+	errs := make([]error, runs)
+	var wg sync.WaitGroup
+	for i := range runs {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			var buf bytes.Buffer
+			_, errs[i] = converter.Convert(context.Background(), []string{"docs"}, &buf)
+			outputs[i] = buf.Bytes()
+		}()
+	}
+	wg.Wait()
+
+	for i := range runs {
+		if errs[i] != nil {
+			t.Fatalf("conversion %d failed: %v", i, errs[i])
+		}
+		if !bytes.Equal(outputs[i], outputs[0]) {
+			t.Errorf("conversion %d produced a different archive than conversion 0", i)
+		}
+	}
+	if dirs := converter.WatchDirs(); len(dirs) == 0 {
+		t.Errorf("WatchDirs returned nothing after converting")
+	}
+}
+
+func TestConvertUncleanFolder(t *testing.T) {
+	for _, folder := range []string{"docs", "docs/", "./docs", "docs/notes/.."} {
+		converter := NewConverter(Options{FS: testFS(), Timestamp: time.Unix(1, 0)})
+		report, err := converter.Convert(context.Background(), []string{folder}, io.Discard)
+		if err != nil {
+			t.Errorf("Convert(%q) failed: %v", folder, err)
+			continue
+		}
+		if converted := report.Count(StatusConverted); converted != 2 {
+			t.Errorf("Convert(%q) converted %d files, want 2", folder, converted)
+		}
+	}
+}
+
+func TestConvertFoldersAmongSources(t *testing.T) {
+	fsys := testFS()
+	fsys["docs/draft.md"] = &fstest.MapFile{Data: []byte("# Draft\n")}
+	fsys["todo.md"] = &fstest.MapFile{Data: []byte("# Todo\n")}
+	converter := NewConverter(Options{
+		FS:        fsys,
+		Timestamp: time.Unix(1, 0),
+		Recursive: true,
+		Exclude:   []string{"draft.md"},
+	})
+
+	report, err := converter.Convert(context.Background(), []string{"docs", "todo.md", "docs/intro.md"}, io.Discard)
+	if err != nil {
+		t.Fatal(err)
+	}
+	statuses := make(map[string]string)
+	for _, file := range report.Files {
+		if _, ok := statuses[file.Source]; ok {
+			t.Errorf("%s is in the report more than once", file.Source)
+		}
+		statuses[file.Source] = file.Status
+	}
+	want := map[string]string{
+		"docs/intro.md":       StatusConverted,
+		"docs/guide.md":       StatusConverted,
+		"docs/notes/extra.md": StatusConverted,
+		"docs/draft.md":       StatusSkipped,
+		"todo.md":             StatusConverted,
+	}
+	for source, status := range want {
+		if statuses[source] != status {
+			t.Errorf("%s is %q, want %q", source, statuses[source], status)
+		}
+	}
+}
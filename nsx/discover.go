@@ -0,0 +1,113 @@
+package nsx
+
+import (
+	"context"
+	"fmt"
+	"io/fs"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// Reasons a file is skipped during discovery
+const (
+	skipExcluded    = "excluded"
+	skipIgnored     = "ignored by " + ignoreFileName
+	skipNotIncluded = "not included"
+)
+
+// discoverFiles finds the markdown files in mdFolder, descending into
+// subfolders when Recursive is set. Files and folders matched by an Exclude
+// pattern or the folder's .nsxignore are skipped, as are files not matched by
+// any Include pattern. A summary of the skipped files is printed and they are
+// returned as skipped file reports.
+func (c *Converter) discoverFiles(ctx context.Context, mdFolder string) ([]string, []FileReport, error) {
+	source := c.source()
+	ignore, err := loadIgnoreFile(source, filepath.Join(mdFolder, ignoreFileName))
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to read %s: %w", ignoreFileName, err)
+	}
+	exclude, err := newIgnoreMatcher(c.Options.Exclude)
+	if err != nil {
+		return nil, nil, fmt.Errorf("invalid Exclude pattern: %w", err)
+	}
+	include, err := newIgnoreMatcher(c.Options.Include)
+	if err != nil {
+		return nil, nil, fmt.Errorf("invalid Include pattern: %w", err)
+	}
+
+	mdFiles := make([]string, 0)
+	skipped := make(map[string]int)
+	reports := make([]FileReport, 0)
+	skip := func(filePath, reason, pattern string) {
+		skipped[reason]++
+		reports = append(reports, skippedFile(filePath, fmt.Sprintf("%s pattern %q", reason, pattern)))
+		c.logger().Info("Skipping", "path", filePath, "reason", reason, "pattern", pattern)
+	}
+
+	err = source.WalkDir(mdFolder, func(filePath string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		if filePath == mdFolder {
+			return nil
+		}
+
+		rel := relativePath(mdFolder, filePath)
+		if entry.IsDir() {
+			if !c.Options.Recursive {
+				return filepath.SkipDir
+			}
+			if matched, pattern := exclude.Match(rel, true); matched {
+				skip(filePath+"/", skipExcluded, pattern)
+				return filepath.SkipDir
+			}
+			if matched, pattern := ignore.Match(rel, true); matched {
+				skip(filePath+"/", skipIgnored, pattern)
+				return filepath.SkipDir
+			}
+			return nil
+		}
+
+		if !strings.HasSuffix(entry.Name(), ".md") {
+			return nil
+		}
+		if matched, pattern := exclude.Match(rel, false); matched {
+			skip(filePath, skipExcluded, pattern)
+			return nil
+		}
+		if matched, pattern := ignore.Match(rel, false); matched {
+			skip(filePath, skipIgnored, pattern)
+			return nil
+		}
+		if !include.Empty() {
+			if matched, _ := include.Match(rel, false); !matched {
+				skipped[skipNotIncluded]++
+				reports = append(reports, skippedFile(filePath, skipNotIncluded))
+				return nil
+			}
+		}
+
+		mdFiles = append(mdFiles, filePath)
+		return nil
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if len(skipped) > 0 {
+		reasons := make([]string, 0, len(skipped))
+		total := 0
+		for reason, count := range skipped {
+			reasons = append(reasons, fmt.Sprintf("%d %s", count, reason))
+			total += count
+		}
+		sort.Strings(reasons)
+		c.logger().Info("Skipped entries", "total", total, "reasons", strings.Join(reasons, ", "))
+	}
+
+	return mdFiles, reports, nil
+}
@@ -0,0 +1,19 @@
+// Package nsx converts markdown files into Synology Note Station (NSX)
+// archives. It is the engine behind the md2nsx command.
+//
+// A Converter is created from Options and converts files or folders either
+// into an io.Writer or into NSX files on disk:
+//
+//	converter := nsx.NewConverter(nsx.Options{Notebook: "Handbook"})
+//	report, err := converter.Convert(ctx, []string{"docs"}, w)
+//
+// Every conversion returns a Report describing what happened to each source
+// file. Files that fail to convert are recorded in the report and skipped,
+// unless Options.Strict is set.
+//
+// Sources are read from the operating system's file system unless
+// Options.FS is set, for example to an embed.FS or an in-memory tree:
+//
+//	converter := nsx.NewConverter(nsx.Options{FS: docsFS})
+//	report, err := converter.ConvertToFiles(ctx, []string{"."}, "docs.nsx")
+package nsx
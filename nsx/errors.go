@@ -0,0 +1,38 @@
+package nsx
+
+import (
+	"errors"
+	"fmt"
+)
+
+var (
+	// ErrNoMarkdownFiles is returned when the sources contain no markdown files
+	ErrNoMarkdownFiles = errors.New("no markdown files found")
+	// ErrOutputExists is returned when an output file already exists and
+	// Options.Force is not set
+	ErrOutputExists = errors.New("output file already exists")
+	// ErrCannotSplit is returned when an archive written to an io.Writer
+	// would have to be split to respect the split limits
+	ErrCannotSplit = errors.New("an archive written to a stream cannot be split into several NSX files")
+	// ErrArchiveTooLarge is returned by NewArchive when the files in an
+	// archive add up to more than the size limit
+	ErrArchiveTooLarge = errors.New("archive content exceeds the size limit")
+)
+
+// FileError reports a markdown file that could not be converted. Op
+// describes the step that failed.
+type FileError struct {
+	Op   string
+	Path string
+	Err  error
+}
+
+// Error implements error
+func (e *FileError) Error() string {
+	return fmt.Sprintf("%s %s: %v", e.Op, e.Path, e.Err)
+}
+
+// Unwrap returns the underlying error
+func (e *FileError) Unwrap() error {
+	return e.Err
+}
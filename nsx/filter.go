@@ -0,0 +1,177 @@
+package nsx
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+)
+
+// Stages at which a Filter runs
+const (
+	// FilterStageMarkdown filters run on the markdown, before attachments are
+	// resolved and the note is rendered
+	FilterStageMarkdown = "markdown"
+	// FilterStageHTML filters run on the rendered HTML of the note
+	FilterStageHTML = "html"
+)
+
+// Filter is an external command that transforms every note, in the spirit of
+// pandoc filters. For each note the command is started with a FilterDocument
+// encoded as JSON on stdin and must print the transformed document as JSON on
+// stdout. Fields missing from the output keep their value. A non-zero exit
+// status fails the note; anything written to stderr is reported as a warning.
+// Cached notes are rendered again when the command line changes or the
+// content of its program or of a file named by an argument does; other files
+// the filter reads are not tracked.
+type Filter struct {
+	// Command is the program to run followed by its arguments
+	Command []string
+	// Stage is FilterStageMarkdown (the default) or FilterStageHTML
+	Stage string
+	// Dir is the working directory of the command (default: the current one)
+	Dir string
+}
+
+// FilterDocument is the JSON object a Filter reads and writes
+type FilterDocument struct {
+	// Stage is the stage the filter runs at
+	Stage string `json:"stage"`
+	// Source is the path of the markdown file
+	Source string `json:"source"`
+	// Title is the note title
+	Title string `json:"title"`
+	// Tags are the tags of the note
+	Tags []string `json:"tags"`
+	// FrontMatter holds the fields of the file's YAML front matter
+	FrontMatter map[string]any `json:"front_matter"`
+	// Content is the markdown without its front matter, or the rendered
+	// HTML in the html stage
+	Content string `json:"content"`
+}
+
+// stage returns the stage the filter runs at
+func (f Filter) stage() string {
+	if f.Stage == "" {
+		return FilterStageMarkdown
+	}
+	return f.Stage
+}
+
+// String returns the command line of the filter
+func (f Filter) String() string {
+	return strings.Join(f.Command, " ")
+}
+
+// checkFilters reports filters without a command or with an unknown stage
+func (c *Converter) checkFilters() error {
+	for _, filter := range c.Options.Filters {
+		if len(filter.Command) == 0 {
+			return fmt.Errorf("filter without a command")
+		}
+		if stage := filter.stage(); stage != FilterStageMarkdown && stage != FilterStageHTML {
+			return fmt.Errorf("unknown stage '%s' of filter %s (use %s or %s)", filter.Stage, filter, FilterStageMarkdown, FilterStageHTML)
+		}
+	}
+	return nil
+}
+
+// filterFingerprint hashes the files the filters run: each command's
+// executable and every argument naming an existing file, such as the script
+// given to an interpreter. It is part of the cache key, so editing a filter
+// script does not keep serving the notes the old version produced.
+func (c *Converter) filterFingerprint() string {
+	if len(c.Options.Filters) == 0 {
+		return ""
+	}
+	hash := sha256.New()
+	for _, filter := range c.Options.Filters {
+		for i, arg := range filter.Command {
+			path := arg
+			if i == 0 && !strings.ContainsRune(arg, '/') && !strings.ContainsRune(arg, filepath.Separator) {
+				if found, err := exec.LookPath(arg); err == nil {
+					path = found
+				}
+			} else if !filepath.IsAbs(path) && filter.Dir != "" {
+				path = filepath.Join(filter.Dir, path)
+			}
+			fmt.Fprintf(hash, "%d\x00%s\x00", i, fileDigest(path))
+		}
+		hash.Write([]byte{0})
+	}
+	return hex.EncodeToString(hash.Sum(nil))
+}
+
+// fileDigest returns the SHA-256 of a regular file's content, or "" if path
+// does not name one
+func fileDigest(path string) string {
+	info, err := os.Stat(path)
+	if err != nil || !info.Mode().IsRegular() {
+		return ""
+	}
+	file, err := os.Open(path)
+	if err != nil {
+		return ""
+	}
+	defer file.Close()
+	hash := sha256.New()
+	if _, err := io.Copy(hash, file); err != nil {
+		return ""
+	}
+	return hex.EncodeToString(hash.Sum(nil))
+}
+
+// runFilters passes doc through every filter of the given stage in turn
+func (c *Converter) runFilters(ctx context.Context, stage string, doc *FilterDocument, build *noteBuild) error {
+	doc.Stage = stage
+	for _, filter := range c.Options.Filters {
+		if filter.stage() != stage {
+			continue
+		}
+		if err := c.runFilter(ctx, filter, doc, build); err != nil {
+			return fmt.Errorf("filter %s: %w", filter, err)
+		}
+	}
+	return nil
+}
+
+// runFilter runs a single filter command and reads the transformed document
+func (c *Converter) runFilter(ctx context.Context, filter Filter, doc *FilterDocument, build *noteBuild) error {
+	input, err := json.Marshal(doc)
+	if err != nil {
+		return fmt.Errorf("failed to encode note: %w", err)
+	}
+
+	var stdout, stderr bytes.Buffer
+	cmd := exec.CommandContext(ctx, filter.Command[0], filter.Command[1:]...)
+	cmd.Dir = filter.Dir
+	cmd.Stdin = bytes.NewReader(input)
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+
+	c.logger().Debug("Running filter", "filter", filter.String(), "stage", doc.Stage, "file", doc.Source)
+	if err := cmd.Run(); err != nil {
+		if ctxErr := ctx.Err(); ctxErr != nil {
+			return ctxErr
+		}
+		if message := strings.TrimSpace(stderr.String()); message != "" {
+			return fmt.Errorf("%w: %s", err, message)
+		}
+		return err
+	}
+	if message := strings.TrimSpace(stderr.String()); message != "" {
+		build.warn("filter %s: %s", filter, message)
+	}
+
+	if err := json.Unmarshal(stdout.Bytes(), doc); err != nil {
+		return fmt.Errorf("failed to decode filter output: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,32 @@
+package nsx
+
+import (
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// splitFrontMatter separates a leading YAML front matter block, delimited by
+// "---" lines, from the markdown. Without a block the fields are nil and the
+// markdown is returned unchanged. A block that is not valid YAML is left in
+// the markdown and reported as ok == false.
+func splitFrontMatter(mdContent string) (fields map[string]any, body string, ok bool) {
+	normalized := strings.ReplaceAll(mdContent, "\r\n", "\n")
+	if !strings.HasPrefix(normalized, "---\n") {
+		return nil, mdContent, true
+	}
+
+	rest := normalized[len("---\n"):]
+	offset := 0
+	for _, line := range strings.SplitAfter(rest, "\n") {
+		if delimiter := strings.TrimSuffix(line, "\n"); delimiter == "---" || delimiter == "..." {
+			fields = make(map[string]any)
+			if err := yaml.Unmarshal([]byte(rest[:offset]), &fields); err != nil {
+				return nil, mdContent, false
+			}
+			return fields, rest[offset+len(line):], true
+		}
+		offset += len(line)
+	}
+	return nil, mdContent, true
+}
@@ -0,0 +1,51 @@
+package nsx
+
+// Hooks are called at points of a conversion, so library users can adjust
+// notes and collect metrics. Every hook is optional. Apart from OnComplete,
+// hooks may be called from several goroutines at once.
+type Hooks struct {
+	// OnNote is called with every rendered note before it is marshaled. It
+	// may change the note, for example to add a footer to Content or rewrite
+	// its links; returning an error fails the file. Notes are only cached
+	// when Options.CacheKey is set as well, and notes reused from the cache
+	// were passed to OnNote when they were rendered and are not passed again.
+	OnNote func(source string, note *Note) error
+	// OnAttachment is called once for every attachment of a note, including
+	// the notes reused from the cache
+	OnAttachment func(source string, attachment AttachmentReport)
+	// OnWarning is called for every warning raised for a markdown file
+	OnWarning func(source, message string)
+	// OnComplete is called once when Convert or ConvertToFiles returns, with
+	// the same report and error. The report is nil when the conversion failed
+	// before converting any file.
+	OnComplete func(report *Report, err error)
+}
+
+// note runs the OnNote hook
+func (h *Hooks) note(source string, note *Note) error {
+	if h.OnNote == nil {
+		return nil
+	}
+	return h.OnNote(source, note)
+}
+
+// attachment runs the OnAttachment hook
+func (h *Hooks) attachment(source string, attachment AttachmentReport) {
+	if h.OnAttachment != nil {
+		h.OnAttachment(source, attachment)
+	}
+}
+
+// warning runs the OnWarning hook
+func (h *Hooks) warning(source, message string) {
+	if h.OnWarning != nil {
+		h.OnWarning(source, message)
+	}
+}
+
+// complete runs the OnComplete hook
+func (h *Hooks) complete(report *Report, err error) {
+	if h.OnComplete != nil {
+		h.OnComplete(report, err)
+	}
+}
@@ -0,0 +1,189 @@
+package nsx
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io/fs"
+	"regexp"
+	"strings"
+)
+
+// ignoreFileName is read from the root of the markdown folder during discovery
+const ignoreFileName = ".nsxignore"
+
+// ignoreRule is a single compiled pattern in gitignore syntax
+type ignoreRule struct {
+	pattern string
+	regex   *regexp.Regexp
+	negate  bool
+	dirOnly bool
+}
+
+// ignoreMatcher matches slash-separated relative paths against a list of
+// patterns using gitignore semantics: the last matching pattern wins, "!"
+// re-includes, a trailing "/" only matches directories, patterns without a
+// slash match at any depth and "**" spans directories.
+type ignoreMatcher struct {
+	rules []ignoreRule
+}
+
+// newIgnoreMatcher compiles the given patterns
+func newIgnoreMatcher(patterns []string) (*ignoreMatcher, error) {
+	m := &ignoreMatcher{}
+	for _, pattern := range patterns {
+		if err := m.add(pattern); err != nil {
+			return nil, err
+		}
+	}
+	return m, nil
+}
+
+// loadIgnoreFile reads patterns from a gitignore-style file. A missing file
+// yields an empty matcher.
+func loadIgnoreFile(source sourceFS, filePath string) (*ignoreMatcher, error) {
+	file, err := source.Open(filePath)
+	if errors.Is(err, fs.ErrNotExist) {
+		return &ignoreMatcher{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	m := &ignoreMatcher{}
+	scanner := bufio.NewScanner(file)
+	for line := 1; scanner.Scan(); line++ {
+		if err := m.add(scanner.Text()); err != nil {
+			return nil, fmt.Errorf("line %d: %w", line, err)
+		}
+	}
+	return m, scanner.Err()
+}
+
+// add compiles a single pattern line. Blank lines and comments are skipped.
+func (m *ignoreMatcher) add(line string) error {
+	line = strings.TrimRight(line, " \t\r")
+	if line == "" || strings.HasPrefix(line, "#") {
+		return nil
+	}
+
+	rule := ignoreRule{pattern: line}
+	if strings.HasPrefix(line, "!") {
+		rule.negate = true
+		line = line[1:]
+	} else if strings.HasPrefix(line, `\`) {
+		// "\#" and "\!" escape a leading special character
+		line = line[1:]
+	}
+	if strings.HasSuffix(line, "/") {
+		rule.dirOnly = true
+		line = strings.TrimSuffix(line, "/")
+	}
+
+	// A slash anywhere but the end anchors the pattern to the root
+	anchored := strings.Contains(line, "/")
+	line = strings.TrimPrefix(line, "/")
+	if line == "" {
+		return nil
+	}
+
+	expr := globToRegexp(line)
+	if !anchored {
+		expr = "(.*/)?" + expr
+	}
+
+	regex, err := regexp.Compile("^" + expr + "$")
+	if err != nil {
+		return fmt.Errorf("invalid pattern %q: %w", rule.pattern, err)
+	}
+	rule.regex = regex
+	m.rules = append(m.rules, rule)
+	return nil
+}
+
+// Match reports whether rel is matched and, if so, by which pattern. Negated
+// patterns that match report false.
+func (m *ignoreMatcher) Match(rel string, isDir bool) (bool, string) {
+	matched, pattern := false, ""
+	for _, rule := range m.rules {
+		if rule.dirOnly && !isDir {
+			continue
+		}
+		if rule.regex.MatchString(rel) {
+			matched, pattern = !rule.negate, rule.pattern
+		}
+	}
+	return matched, pattern
+}
+
+// Empty reports whether the matcher has no patterns
+func (m *ignoreMatcher) Empty() bool {
+	return len(m.rules) == 0
+}
+
+// globToRegexp translates a gitignore glob into a regular expression
+func globToRegexp(glob string) string {
+	var expr strings.Builder
+	for i := 0; i < len(glob); i++ {
+		ch := glob[i]
+		switch {
+		case ch == '*' && strings.HasPrefix(glob[i:], "**/"):
+			expr.WriteString("(.*/)?")
+			i += 2
+		case ch == '*' && strings.HasPrefix(glob[i:], "**"):
+			expr.WriteString(".*")
+			i++
+		case ch == '*':
+			expr.WriteString("[^/]*")
+		case ch == '?':
+			expr.WriteString("[^/]")
+		case ch == '[':
+			end := strings.IndexByte(glob[i+1:], ']')
+			if end < 0 {
+				expr.WriteString(`\[`)
+				continue
+			}
+			class := glob[i+1 : i+1+end]
+			if strings.HasPrefix(class, "!") {
+				class = "^" + class[1:]
+			}
+			expr.WriteString("[" + class + "]")
+			i += end + 1
+		case ch == '\\' && i+1 < len(glob):
+			i++
+			expr.WriteString(regexp.QuoteMeta(string(glob[i])))
+		default:
+			expr.WriteString(regexp.QuoteMeta(string(ch)))
+		}
+	}
+	return expr.String()
+}
+
+// matchesAny reports whether rel matches one of the patterns, using the same
+// syntax as .nsxignore. Invalid patterns match nothing; checkPatterns reports
+// them before a conversion starts.
+func matchesAny(patterns []string, rel string) bool {
+	m, err := newIgnoreMatcher(patterns)
+	if err != nil {
+		return false
+	}
+	matched, _ := m.Match(rel, false)
+	return matched
+}
+
+// checkPatterns reports invalid Include, Exclude and TagRules patterns
+func (c *Converter) checkPatterns() error {
+	if _, err := newIgnoreMatcher(c.Options.Include); err != nil {
+		return fmt.Errorf("invalid Include pattern: %w", err)
+	}
+	if _, err := newIgnoreMatcher(c.Options.Exclude); err != nil {
+		return fmt.Errorf("invalid Exclude pattern: %w", err)
+	}
+	for _, rule := range c.Options.TagRules {
+		if _, err := newIgnoreMatcher([]string{rule.Pattern}); err != nil {
+			return fmt.Errorf("invalid tag rule: %w", err)
+		}
+	}
+	return nil
+}
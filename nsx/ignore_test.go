@@ -0,0 +1,124 @@
+package nsx
+
+import (
+	"strings"
+	"testing"
+	"testing/fstest"
+)
+
+func TestIgnoreMatcherMatch(t *testing.T) {
+	tests := []struct {
+		name     string
+		patterns []string
+		path     string
+		isDir    bool
+		matched  bool
+		pattern  string
+	}{
+		{"extension at root", []string{"*.md"}, "a.md", false, true, "*.md"},
+		{"extension at any depth", []string{"*.md"}, "docs/guide/a.md", false, true, "*.md"},
+		{"extension is not a prefix", []string{"*.md"}, "a.mdx", false, false, ""},
+		{"name at any depth", []string{"drafts"}, "notes/drafts", true, true, "drafts"},
+		{"leading slash anchors", []string{"/root.md"}, "root.md", false, true, "/root.md"},
+		{"leading slash does not match deeper", []string{"/root.md"}, "docs/root.md", false, false, ""},
+		{"inner slash anchors", []string{"docs/*.md"}, "docs/a.md", false, true, "docs/*.md"},
+		{"inner slash does not match deeper", []string{"docs/*.md"}, "x/docs/a.md", false, false, ""},
+		{"star does not cross slashes", []string{"docs/*.md"}, "docs/sub/a.md", false, false, ""},
+		{"trailing slash matches directories", []string{"build/"}, "a/build", true, true, "build/"},
+		{"trailing slash skips files", []string{"build/"}, "build", false, false, ""},
+		{"leading double star at root", []string{"**/tmp"}, "tmp", true, true, "**/tmp"},
+		{"leading double star deeper", []string{"**/tmp"}, "a/b/tmp", true, true, "**/tmp"},
+		{"trailing double star", []string{"logs/**"}, "logs/2024/jan.md", false, true, "logs/**"},
+		{"trailing double star skips the folder itself", []string{"logs/**"}, "logs", true, false, ""},
+		{"inner double star spans nothing", []string{"a/**/b.md"}, "a/b.md", false, true, "a/**/b.md"},
+		{"inner double star spans folders", []string{"a/**/b.md"}, "a/x/y/b.md", false, true, "a/**/b.md"},
+		{"question mark matches one character", []string{"file?.md"}, "file1.md", false, true, "file?.md"},
+		{"question mark matches only one character", []string{"file?.md"}, "file10.md", false, false, ""},
+		{"question mark does not match a slash", []string{"file?.md"}, "file/.md", false, false, ""},
+		{"character class", []string{"[abc].md"}, "b.md", false, true, "[abc].md"},
+		{"character range", []string{"[0-9]*.md"}, "2024-notes.md", false, true, "[0-9]*.md"},
+		{"negated character class", []string{"[!abc].md"}, "a.md", false, false, ""},
+		{"negated character class matches others", []string{"[!abc].md"}, "d.md", false, true, "[!abc].md"},
+		{"unclosed bracket is literal", []string{"[draft.md"}, "[draft.md", false, true, "[draft.md"},
+		{"escaped hash", []string{`\#hash.md`}, "#hash.md", false, true, `\#hash.md`},
+		{"escaped bang", []string{`\!bang.md`}, "!bang.md", false, true, `\!bang.md`},
+		{"escaped star is literal", []string{`a\*.md`}, "ab.md", false, false, ""},
+		{"dots are literal", []string{"a.md"}, "aamd", false, false, ""},
+		{"comment is not a pattern", []string{"#a.md"}, "#a.md", false, false, ""},
+		{"trailing spaces are trimmed", []string{"a.md  "}, "a.md", false, true, "a.md"},
+		{"negation re-includes", []string{"*.md", "!keep.md"}, "keep.md", false, false, "!keep.md"},
+		{"negation leaves others excluded", []string{"*.md", "!keep.md"}, "other.md", false, true, "*.md"},
+		{"last matching pattern wins", []string{"!a.md", "*.md"}, "a.md", false, true, "*.md"},
+		{"no patterns", nil, "a.md", false, false, ""},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			m, err := newIgnoreMatcher(test.patterns)
+			if err != nil {
+				t.Fatalf("newIgnoreMatcher(%q) failed: %v", test.patterns, err)
+			}
+			matched, pattern := m.Match(test.path, test.isDir)
+			if matched != test.matched || pattern != test.pattern {
+				t.Errorf("Match(%q, %v) with %q = %v, %q; want %v, %q",
+					test.path, test.isDir, test.patterns, matched, pattern, test.matched, test.pattern)
+			}
+		})
+	}
+}
+
+func TestIgnoreMatcherInvalidPattern(t *testing.T) {
+	for _, pattern := range []string{"[z-a].md", "notes/[b-a]*"} {
+		if _, err := newIgnoreMatcher([]string{"*.tmp", pattern}); err == nil {
+			t.Errorf("newIgnoreMatcher accepted invalid pattern %q", pattern)
+		} else if !strings.Contains(err.Error(), pattern) {
+			t.Errorf("error %q does not name pattern %q", err, pattern)
+		}
+	}
+}
+
+func TestIgnoreMatcherEmpty(t *testing.T) {
+	m, err := newIgnoreMatcher([]string{"", "# only a comment", "   ", "/"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !m.Empty() {
+		t.Errorf("matcher with only blank lines and comments is not empty")
+	}
+}
+
+func TestLoadIgnoreFile(t *testing.T) {
+	source := sourceFS{fsys: fstest.MapFS{
+		"notes/.nsxignore": {Data: []byte("# drafts\ndrafts/\n*.tmp.md\n!keep.tmp.md\n")},
+		"bad/.nsxignore":   {Data: []byte("*.tmp.md\n\n[z-a]\n")},
+	}, custom: true}
+
+	m, err := loadIgnoreFile(source, "notes/.nsxignore")
+	if err != nil {
+		t.Fatal(err)
+	}
+	checks := []struct {
+		path    string
+		isDir   bool
+		matched bool
+	}{
+		{"drafts", true, true},
+		{"a.tmp.md", false, true},
+		{"keep.tmp.md", false, false},
+		{"a.md", false, false},
+	}
+	for _, check := range checks {
+		if matched, _ := m.Match(check.path, check.isDir); matched != check.matched {
+			t.Errorf("Match(%q, %v) = %v, want %v", check.path, check.isDir, matched, check.matched)
+		}
+	}
+
+	if m, err := loadIgnoreFile(source, "missing/.nsxignore"); err != nil || !m.Empty() {
+		t.Errorf("missing ignore file: got %v, %v; want an empty matcher", m, err)
+	}
+
+	_, err = loadIgnoreFile(source, "bad/.nsxignore")
+	if err == nil || !strings.Contains(err.Error(), "line 3") {
+		t.Errorf("invalid ignore file: got error %v, want one naming line 3", err)
+	}
+}
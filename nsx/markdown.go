@@ -0,0 +1,125 @@
+package nsx
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+
+	chromahtml "github.com/alecthomas/chroma/formatters/html"
+	"github.com/yuin/goldmark"
+	highlighting "github.com/yuin/goldmark-highlighting"
+	"github.com/yuin/goldmark/extension"
+	"github.com/yuin/goldmark/renderer"
+	rendererhtml "github.com/yuin/goldmark/renderer/html"
+	"github.com/yuin/goldmark/util"
+)
+
+// Names of the built-in goldmark extensions, for Options.DisableExtensions
+const (
+	ExtensionTable          = "table"
+	ExtensionStrikethrough  = "strikethrough"
+	ExtensionLinkify        = "linkify"
+	ExtensionTaskList       = "tasklist"
+	ExtensionFootnote       = "footnote"
+	ExtensionDefinitionList = "definition-list"
+	ExtensionTypographer    = "typographer"
+	ExtensionHighlighting   = "highlighting"
+)
+
+// BuiltinExtensions lists the built-in extensions in the order they are
+// applied. The first four make up GitHub Flavored Markdown.
+var BuiltinExtensions = []string{
+	ExtensionTable,
+	ExtensionStrikethrough,
+	ExtensionLinkify,
+	ExtensionTaskList,
+	ExtensionFootnote,
+	ExtensionDefinitionList,
+	ExtensionTypographer,
+	ExtensionHighlighting,
+}
+
+// newMarkdown builds the goldmark instance shared by every note of a run:
+// Options.Markdown if set, otherwise the built-in extensions that are not
+// disabled followed by Options.MarkdownExtensions and Options.NodeRenderers
+func (c *Converter) newMarkdown() (goldmark.Markdown, error) {
+	if c.Options.Markdown != nil {
+		return c.Options.Markdown, nil
+	}
+
+	for _, name := range c.Options.DisableExtensions {
+		if !slices.Contains(BuiltinExtensions, name) {
+			return nil, fmt.Errorf("unknown markdown extension '%s' (known: %s)", name, strings.Join(BuiltinExtensions, ", "))
+		}
+	}
+
+	extensions := make([]goldmark.Extender, 0, len(BuiltinExtensions)+len(c.Options.MarkdownExtensions))
+	for _, name := range BuiltinExtensions {
+		if !slices.Contains(c.Options.DisableExtensions, name) {
+			extensions = append(extensions, c.builtinExtension(name))
+		}
+	}
+	extensions = append(extensions, c.Options.MarkdownExtensions...)
+
+	// Renderers registered later win, and goldmark registers them from the
+	// highest priority value to the lowest
+	nodeRenderers := []util.PrioritizedValue{
+		util.Prioritized(&customCodeSpanRenderer{}, 100),
+		util.Prioritized(&customBlockquoteRenderer{}, 100),
+	}
+	nodeRenderers = append(nodeRenderers, c.Options.NodeRenderers...)
+
+	rendererOptions := []renderer.Option{
+		rendererhtml.WithXHTML(),
+		rendererhtml.WithUnsafe(),
+		rendererhtml.WithHardWraps(),
+		renderer.WithNodeRenderers(nodeRenderers...),
+	}
+
+	return goldmark.New(
+		goldmark.WithExtensions(extensions...),
+		goldmark.WithRendererOptions(rendererOptions...),
+	), nil
+}
+
+// builtinExtension returns the goldmark extension of a built-in name
+func (c *Converter) builtinExtension(name string) goldmark.Extender {
+	switch name {
+	case ExtensionTable:
+		return extension.Table
+	case ExtensionStrikethrough:
+		return extension.Strikethrough
+	case ExtensionLinkify:
+		return extension.Linkify
+	case ExtensionTaskList:
+		return extension.TaskList
+	case ExtensionFootnote:
+		return extension.Footnote
+	case ExtensionDefinitionList:
+		return extension.DefinitionList
+	case ExtensionTypographer:
+		return extension.Typographer
+	}
+
+	return highlighting.NewHighlighting(
+		highlighting.WithStyle(c.theme()),
+		highlighting.WithGuessLanguage(true),
+		highlighting.WithWrapperRenderer(func(w util.BufWriter, context highlighting.CodeBlockContext, entering bool) {
+			if entering {
+				language, _ := context.Language()
+				_, _ = w.WriteString(`<div style="` + styleCodeBlock + `"><pre class="language-` + string(language) + `">`)
+			} else {
+				_, _ = w.WriteString(`</pre></div>`)
+			}
+		}),
+		highlighting.WithCodeBlockOptions(func(ctx highlighting.CodeBlockContext) []chromahtml.Option {
+			return []chromahtml.Option{
+				chromahtml.WithClasses(false),
+				chromahtml.WithLineNumbers(true),
+				chromahtml.WithAllClasses(false),
+				chromahtml.TabWidth(4),
+				chromahtml.WithPreWrapper(&customCodeBlockPreWrapper{}),
+			}
+		}),
+	)
+}
@@ -0,0 +1,89 @@
+package nsx
+
+import (
+	"io"
+	"log/slog"
+	"sync"
+	"time"
+)
+
+// discardLogger is used when Options.Logger is nil
+var discardLogger = slog.New(slog.DiscardHandler)
+
+// Progress is a snapshot of a running conversion
+type Progress struct {
+	// Files is the number of markdown files done, converted or failed
+	Files int
+	// Total is the number of markdown files in the conversion
+	Total int
+	// Attachments is the number of attachments processed
+	Attachments int
+	// Bytes is the number of bytes written to the output
+	Bytes int64
+	// Elapsed is the time since the conversion started
+	Elapsed time.Duration
+}
+
+// progressTracker counts the progress of a run and reports every change to
+// a callback. A nil tracker ignores every update.
+type progressTracker struct {
+	mu       sync.Mutex
+	state    Progress
+	start    time.Time
+	callback func(Progress)
+}
+
+// newProgressTracker starts tracking a run over total files. It returns nil
+// when there is no callback to report to.
+func newProgressTracker(total int, callback func(Progress)) *progressTracker {
+	if callback == nil {
+		return nil
+	}
+	return &progressTracker{
+		state:    Progress{Total: total},
+		start:    time.Now(),
+		callback: callback,
+	}
+}
+
+// FileDone records that a file was converted or failed
+func (p *progressTracker) FileDone() {
+	p.update(func(state *Progress) { state.Files++ })
+}
+
+// AttachmentDone records that an attachment was processed
+func (p *progressTracker) AttachmentDone() {
+	p.update(func(state *Progress) { state.Attachments++ })
+}
+
+// Written records bytes written to the output
+func (p *progressTracker) Written(n int) {
+	p.update(func(state *Progress) { state.Bytes += int64(n) })
+}
+
+// update applies change and reports the new state
+func (p *progressTracker) update(change func(*Progress)) {
+	if p == nil {
+		return
+	}
+	p.mu.Lock()
+	change(&p.state)
+	p.state.Elapsed = time.Since(p.start)
+	state := p.state
+	p.mu.Unlock()
+
+	p.callback(state)
+}
+
+// countingWriter reports the bytes written through it to a progress tracker
+type countingWriter struct {
+	w        io.Writer
+	progress *progressTracker
+}
+
+// Write writes to the underlying writer and records the bytes written
+func (cw *countingWriter) Write(b []byte) (int, error) {
+	n, err := cw.w.Write(b)
+	cw.progress.Written(n)
+	return n, err
+}
@@ -0,0 +1,158 @@
+package nsx
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+)
+
+// Status values of a FileReport
+const (
+	StatusConverted = "converted"
+	StatusCached    = "cached"
+	StatusFailed    = "failed"
+	StatusSkipped   = "skipped"
+)
+
+// Report describes the outcome of a conversion run, or the plan of a dry run
+type Report struct {
+	Notebook   string       `json:"notebook"`
+	NotebookID string       `json:"notebook_id"`
+	DryRun     bool         `json:"dry_run"`
+	Outputs    []string     `json:"outputs"`
+	Files      []FileReport `json:"files"`
+}
+
+// FileReport describes what happened to a single source file
+type FileReport struct {
+	Source      string             `json:"source"`
+	Status      string             `json:"status"`
+	NoteID      string             `json:"note_id,omitempty"`
+	Title       string             `json:"title,omitempty"`
+	Part        int                `json:"part,omitempty"`
+	Reason      string             `json:"reason,omitempty"`
+	Error       string             `json:"error,omitempty"`
+	Warnings    []string           `json:"warnings"`
+	Attachments []AttachmentReport `json:"attachments"`
+}
+
+// AttachmentReport describes an attachment of a note
+type AttachmentReport struct {
+	Key    string `json:"key"`
+	Name   string `json:"name"`
+	Source string `json:"source"`
+	Type   string `json:"type"`
+	Size   int64  `json:"size"`
+}
+
+// newFileReport describes the result of converting mdFile. The note ID and
+// part are filled in once the note has been packaged.
+func newFileReport(mdFile string, result convertedNote) FileReport {
+	file := FileReport{
+		Source:      mdFile,
+		Status:      StatusConverted,
+		Title:       result.title,
+		Warnings:    result.warnings,
+		Attachments: result.attachments,
+	}
+	if result.cached {
+		file.Status = StatusCached
+	}
+	if result.err != nil {
+		file.Status = StatusFailed
+		file.Error = result.err.Error()
+	}
+	if file.Warnings == nil {
+		file.Warnings = make([]string, 0)
+	}
+	if file.Attachments == nil {
+		file.Attachments = make([]AttachmentReport, 0)
+	}
+	return file
+}
+
+// skippedFile describes a file left out during discovery
+func skippedFile(filePath, reason string) FileReport {
+	return FileReport{
+		Source:      filePath,
+		Status:      StatusSkipped,
+		Reason:      reason,
+		Warnings:    make([]string, 0),
+		Attachments: make([]AttachmentReport, 0),
+	}
+}
+
+// Count returns how many files have the given status
+func (r *Report) Count(status string) int {
+	count := 0
+	for _, file := range r.Files {
+		if file.Status == status {
+			count++
+		}
+	}
+	return count
+}
+
+// WriteFile saves the report as indented JSON
+func (r *Report) WriteFile(reportPath string) error {
+	data, err := json.MarshalIndent(r, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal report: %w", err)
+	}
+	if err := os.WriteFile(reportPath, append(data, '\n'), 0644); err != nil {
+		return fmt.Errorf("failed to write report: %w", err)
+	}
+	return nil
+}
+
+// WritePlan prints the report as a human readable conversion plan
+func (r *Report) WritePlan(w io.Writer) {
+	fmt.Fprintf(w, "Notebook: %s (%s)\n", r.Notebook, r.NotebookID)
+	for i, output := range r.Outputs {
+		fmt.Fprintf(w, "Output %d: %s\n", i+1, output)
+	}
+
+	notes := r.Count(StatusConverted) + r.Count(StatusCached)
+	fmt.Fprintf(w, "Notes: %d\n", notes)
+	warnings := 0
+	attachments := 0
+	for _, file := range r.Files {
+		if file.Status != StatusConverted && file.Status != StatusCached {
+			continue
+		}
+		part := ""
+		if len(r.Outputs) > 1 {
+			part = fmt.Sprintf(" [part %d]", file.Part)
+		}
+		fmt.Fprintf(w, "  %s -> %s %q%s\n", file.Source, file.NoteID, file.Title, part)
+		for _, attachment := range file.Attachments {
+			fmt.Fprintf(w, "    attachment: %s (%s, %d bytes) from %s\n", attachment.Name, attachment.Type, attachment.Size, attachment.Source)
+		}
+		for _, warning := range file.Warnings {
+			fmt.Fprintf(w, "    warning: %s\n", warning)
+		}
+		attachments += len(file.Attachments)
+		warnings += len(file.Warnings)
+	}
+
+	if failed := r.Count(StatusFailed); failed > 0 {
+		fmt.Fprintf(w, "Failed: %d\n", failed)
+		for _, file := range r.Files {
+			if file.Status == StatusFailed {
+				fmt.Fprintf(w, "  %s: %s\n", file.Source, file.Error)
+			}
+		}
+	}
+	if skipped := r.Count(StatusSkipped); skipped > 0 {
+		fmt.Fprintf(w, "Skipped: %d\n", skipped)
+		for _, file := range r.Files {
+			if file.Status == StatusSkipped {
+				fmt.Fprintf(w, "  %s: %s\n", file.Source, file.Reason)
+			}
+		}
+	}
+
+	fmt.Fprintf(w, "Attachments: %d\n", attachments)
+	fmt.Fprintf(w, "Warnings: %d\n", warnings)
+}
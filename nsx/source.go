@@ -0,0 +1,79 @@
+package nsx
+
+import (
+	"context"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+)
+
+// osFS is the default source file system. Unlike os.DirFS it accepts any
+// operating system path, relative to the working directory or absolute, so
+// paths given on the command line work unchanged.
+type osFS struct{}
+
+// Open opens the named file
+func (osFS) Open(name string) (fs.File, error) {
+	return os.Open(name)
+}
+
+// Stat returns information about the named file
+func (osFS) Stat(name string) (fs.FileInfo, error) {
+	return os.Stat(name)
+}
+
+// sourceFS reads markdown files and attachments. The converter builds paths
+// with the filepath package; sourceFS turns them into slash-separated names
+// for a custom fs.FS and hands the names it walks back as file paths.
+type sourceFS struct {
+	fsys   fs.FS
+	custom bool
+}
+
+// source returns the file system sources are read from
+func (c *Converter) source() sourceFS {
+	if c.Options.FS == nil {
+		return sourceFS{fsys: osFS{}}
+	}
+	return sourceFS{fsys: c.Options.FS, custom: true}
+}
+
+// name converts a file path into a name within the file system
+func (s sourceFS) name(filePath string) string {
+	if !s.custom {
+		return filePath
+	}
+	return filepath.ToSlash(filepath.Clean(filePath))
+}
+
+// Open opens a file
+func (s sourceFS) Open(filePath string) (fs.File, error) {
+	return s.fsys.Open(s.name(filePath))
+}
+
+// Stat returns information about a file
+func (s sourceFS) Stat(filePath string) (fs.FileInfo, error) {
+	return fs.Stat(s.fsys, s.name(filePath))
+}
+
+// ReadFile reads a whole file, giving up when ctx is done
+func (s sourceFS) ReadFile(ctx context.Context, filePath string) ([]byte, error) {
+	file, err := s.Open(filePath)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	return io.ReadAll(&contextReader{ctx: ctx, r: file})
+}
+
+// WalkDir walks the tree rooted at root like filepath.WalkDir
+func (s sourceFS) WalkDir(root string, fn fs.WalkDirFunc) error {
+	if !s.custom {
+		return filepath.WalkDir(root, fn)
+	}
+	return fs.WalkDir(s.fsys, s.name(root), func(name string, entry fs.DirEntry, err error) error {
+		return fn(filepath.FromSlash(name), entry, err)
+	})
+}
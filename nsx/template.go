@@ -0,0 +1,234 @@
+package nsx
+
+import (
+	"bytes"
+	"fmt"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"text/template"
+	"text/template/parse"
+	"time"
+)
+
+// TemplateData is available to the Header and Footer templates as "."
+type TemplateData struct {
+	// Title is the note title
+	Title string
+	// Path is the markdown file's path relative to the markdown folder,
+	// using forward slashes
+	Path string
+	// Source is the path of the markdown file as it was converted
+	Source string
+	// Tags are the tags of the note
+	Tags []string
+	// FrontMatter holds the fields of the file's YAML front matter
+	FrontMatter map[string]any
+	// Modified is the modification time of the markdown file
+	Modified time.Time
+	// Imported is the time of the conversion, or Options.Timestamp if set
+	Imported time.Time
+
+	// gitDir is where git is asked about the file, "" outside the OS file system
+	gitDir string
+}
+
+// GitCommit returns the abbreviated hash of the last git commit that changed
+// the markdown file, or "" if it is not tracked by git. It runs git only
+// when a template uses it.
+func (d TemplateData) GitCommit() string {
+	if d.gitDir == "" {
+		return ""
+	}
+	output, err := exec.Command("git", "-C", d.gitDir, "log", "-1", "--format=%h", "--", filepath.Base(d.Source)).Output()
+	if err != nil {
+		return ""
+	}
+	return strings.TrimSpace(string(output))
+}
+
+// templateFuncs are the functions available to note templates in addition
+// to the text/template built-ins
+var templateFuncs = template.FuncMap{
+	"join": strings.Join,
+}
+
+// noteTemplates are the parsed header and footer templates of a run, nil
+// when not configured
+type noteTemplates struct {
+	header *template.Template
+	footer *template.Template
+
+	// fields are the TemplateData fields and methods the templates refer
+	// to, with "." standing for all of them
+	fields map[string]bool
+}
+
+// uses reports whether the templates may refer to the TemplateData field
+// or method name
+func (t noteTemplates) uses(name string) bool {
+	return t.fields[name] || t.fields["."]
+}
+
+// parseTemplates parses Options.Header and Options.Footer
+func (c *Converter) parseTemplates() (noteTemplates, error) {
+	var templates noteTemplates
+	var err error
+	if c.Options.Header != "" {
+		if templates.header, err = template.New("header").Funcs(templateFuncs).Parse(c.Options.Header); err != nil {
+			return templates, fmt.Errorf("failed to parse header template: %w", err)
+		}
+	}
+	if c.Options.Footer != "" {
+		if templates.footer, err = template.New("footer").Funcs(templateFuncs).Parse(c.Options.Footer); err != nil {
+			return templates, fmt.Errorf("failed to parse footer template: %w", err)
+		}
+	}
+	templates.fields = make(map[string]bool)
+	for _, tmpl := range []*template.Template{templates.header, templates.footer} {
+		if tmpl == nil {
+			continue
+		}
+		for _, defined := range tmpl.Templates() {
+			if defined.Tree != nil {
+				templateFields(defined.Tree.Root, templates.fields)
+			}
+		}
+	}
+	return templates, nil
+}
+
+// templateFields adds the names of the fields and methods referred to in the
+// parse tree below node to fields. Uses of dot or "$" on their own, which
+// hand all of the data to something else, are recorded as ".". The result
+// may include more names than the template really reads from TemplateData,
+// such as fields of its front matter, but never fewer.
+func templateFields(node parse.Node, fields map[string]bool) {
+	switch node := node.(type) {
+	case *parse.ListNode:
+		if node == nil {
+			return
+		}
+		for _, child := range node.Nodes {
+			templateFields(child, fields)
+		}
+	case *parse.ActionNode:
+		templateFields(node.Pipe, fields)
+	case *parse.PipeNode:
+		if node == nil {
+			return
+		}
+		for _, cmd := range node.Cmds {
+			templateFields(cmd, fields)
+		}
+	case *parse.CommandNode:
+		for _, arg := range node.Args {
+			templateFields(arg, fields)
+		}
+	case *parse.ChainNode:
+		templateFields(node.Node, fields)
+	case *parse.FieldNode:
+		fields[node.Ident[0]] = true
+	case *parse.VariableNode:
+		if node.Ident[0] == "$" {
+			if len(node.Ident) > 1 {
+				fields[node.Ident[1]] = true
+			} else {
+				fields["."] = true
+			}
+		}
+	case *parse.DotNode:
+		fields["."] = true
+	case *parse.IfNode:
+		templateFields(&node.BranchNode, fields)
+	case *parse.RangeNode:
+		templateFields(&node.BranchNode, fields)
+	case *parse.WithNode:
+		templateFields(&node.BranchNode, fields)
+	case *parse.BranchNode:
+		templateFields(node.Pipe, fields)
+		templateFields(node.List, fields)
+		templateFields(node.ElseList, fields)
+	case *parse.TemplateNode:
+		templateFields(node.Pipe, fields)
+	}
+}
+
+// templateData returns the template data that depends on the markdown file
+// rather than its content
+func (c *conversion) templateData(source string) TemplateData {
+	data := TemplateData{
+		Path:     relativePath(c.root, source),
+		Source:   source,
+		Imported: c.timestamp,
+	}
+	if info, err := c.source().Stat(source); err == nil {
+		data.Modified = info.ModTime()
+	}
+	if c.Options.FS == nil {
+		data.gitDir = filepath.Dir(source)
+	}
+	return data
+}
+
+// templateCacheKey returns the template data that is not derived from the
+// markdown content, so a cached note is rendered again when the path,
+// import time, modification time or last commit it shows changes. Data the
+// templates do not refer to is left out, so that for example notes without
+// a fixed timestamp stay cached unless a template shows the import time.
+func (c *conversion) templateCacheKey(source string) string {
+	if c.templates.header == nil && c.templates.footer == nil {
+		return ""
+	}
+	data := c.templateData(source)
+	parts := make([]string, 0, 4)
+	if c.templates.uses("Path") {
+		parts = append(parts, "path="+data.Path)
+	}
+	if c.templates.uses("Imported") {
+		parts = append(parts, fmt.Sprintf("imported=%d", data.Imported.UnixNano()))
+	}
+	if c.templates.uses("Modified") {
+		parts = append(parts, fmt.Sprintf("modified=%d", data.Modified.UnixNano()))
+	}
+	if c.templates.uses("GitCommit") {
+		parts = append(parts, "commit="+data.GitCommit())
+	}
+	return strings.Join(parts, "\x00")
+}
+
+// applyTemplates adds the rendered header and footer to the markdown of doc
+func (c *conversion) applyTemplates(doc *FilterDocument) error {
+	if c.templates.header == nil && c.templates.footer == nil {
+		return nil
+	}
+
+	data := c.templateData(doc.Source)
+	data.Title = doc.Title
+	data.Tags = doc.Tags
+	data.FrontMatter = doc.FrontMatter
+
+	render := func(tmpl *template.Template) (string, error) {
+		var buf bytes.Buffer
+		if err := tmpl.Execute(&buf, data); err != nil {
+			return "", err
+		}
+		return strings.TrimRight(buf.String(), "\n"), nil
+	}
+
+	if c.templates.header != nil {
+		header, err := render(c.templates.header)
+		if err != nil {
+			return err
+		}
+		doc.Content = header + "\n\n" + doc.Content
+	}
+	if c.templates.footer != nil {
+		footer, err := render(c.templates.footer)
+		if err != nil {
+			return err
+		}
+		doc.Content = strings.TrimRight(doc.Content, "\n") + "\n\n" + footer + "\n"
+	}
+	return nil
+}
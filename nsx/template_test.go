@@ -0,0 +1,39 @@
+package nsx
+
+import (
+	"reflect"
+	"slices"
+	"testing"
+)
+
+func TestTemplateFields(t *testing.T) {
+	tests := []struct {
+		template string
+		want     []string
+	}{
+		{"Title {{.Title}}", []string{"Title"}},
+		{"{{.Imported.Format \"2006-01-02\"}}", []string{"Imported"}},
+		{"{{with .Modified}}{{.Year}}{{end}}", []string{"Modified", "Year"}},
+		{"{{if .Tags}}{{join .Tags \", \"}}{{else}}{{$.GitCommit}}{{end}}", []string{"GitCommit", "Tags"}},
+		{"{{range $key, $value := .FrontMatter}}{{$key}}{{end}}", []string{"FrontMatter"}},
+		{"{{(.Imported).Unix}}", []string{"Imported"}},
+		{"{{define \"t\"}}{{.Path}}{{end}}{{template \"t\" .}}", []string{".", "Path"}},
+		{"{{printf \"%v\" $}}", []string{"."}},
+		{"plain text", []string{}},
+	}
+	for _, test := range tests {
+		converter := NewConverter(Options{Header: test.template})
+		templates, err := converter.parseTemplates()
+		if err != nil {
+			t.Fatalf("parseTemplates(%q) failed: %v", test.template, err)
+		}
+		fields := make([]string, 0)
+		for field := range templates.fields {
+			fields = append(fields, field)
+		}
+		slices.Sort(fields)
+		if !reflect.DeepEqual(fields, test.want) {
+			t.Errorf("fields of %q = %q, want %q", test.template, fields, test.want)
+		}
+	}
+}
@@ -0,0 +1,414 @@
+package nsx
+
+import (
+	"archive/zip"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"log/slog"
+	"math/rand/v2"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// storedFile records where the data of an attachment can be read from when it
+// is copied into the archive
+type storedFile struct {
+	MD5Hash string `json:"md5"`
+	Path    string `json:"path"`
+	Size    int64  `json:"size"`
+}
+
+// nsxWriter streams notes and attachments into one or more NSX archives. Each
+// archive is written to a temporary file next to the final output and only
+// renamed into place by Close, so an aborted run never leaves a partial file.
+// A writer with a stream writes a single archive to the stream instead. In a
+// dry run the parts are only planned and nothing is written.
+type nsxWriter struct {
+	stream        io.Writer
+	outputNSXPath string
+	notebookName  string
+	notebookID    string
+	modified      time.Time
+	options       Options
+	logger        *slog.Logger
+	progress      *progressTracker
+	source        sourceFS
+
+	done    []string
+	current *nsxPartWriter
+}
+
+// nsxPartWriter is a single NSX archive that is currently being written
+type nsxPartWriter struct {
+	file      *os.File
+	zipWriter *zip.Writer
+	noteIDs   []string
+	files     map[string]bool
+	size      int64
+}
+
+// newNSXWriter creates a writer for stream or, if stream is nil, for the
+// given output path. Attachments are copied from source. The bytes written
+// are reported to progress, which may be nil.
+func newNSXWriter(stream io.Writer, outputNSXPath, notebookName, notebookID string, modified time.Time, options Options, logger *slog.Logger, progress *progressTracker, source sourceFS) *nsxWriter {
+	return &nsxWriter{
+		stream:        stream,
+		outputNSXPath: outputNSXPath,
+		notebookName:  notebookName,
+		notebookID:    notebookID,
+		modified:      modified.UTC(),
+		options:       options,
+		logger:        logger,
+		progress:      progress,
+		source:        source,
+	}
+}
+
+// AddNote writes a note and the attachment files it needs to the current part,
+// starting a new part first if the note would exceed the split limits.
+// Copying attachments stops with the context's error when ctx is done.
+func (w *nsxWriter) AddNote(ctx context.Context, noteID string, noteData []byte, files []storedFile) error {
+	if w.current != nil && len(w.current.noteIDs) > 0 && w.exceedsLimits(w.current, w.noteCost(w.current, noteData, files)) {
+		if w.toStream() {
+			return ErrCannotSplit
+		}
+		if err := w.finishPart(); err != nil {
+			return err
+		}
+	}
+
+	if w.current == nil {
+		if err := w.startPart(); err != nil {
+			return err
+		}
+	}
+
+	part := w.current
+	part.size += w.noteCost(part, noteData, files)
+
+	writer, err := w.createEntry(part, noteID)
+	if err != nil {
+		return fmt.Errorf("failed to create zip entry %s: %w", noteID, err)
+	}
+	if _, err := writer.Write(noteData); err != nil {
+		return fmt.Errorf("failed to write note %s: %w", noteID, err)
+	}
+	part.noteIDs = append(part.noteIDs, noteID)
+
+	for _, file := range files {
+		if part.files[file.MD5Hash] {
+			continue
+		}
+		part.files[file.MD5Hash] = true
+
+		if err := w.copyFile(ctx, part, file); err != nil {
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+			w.logger.Error("Failed to write attachment", "path", file.Path, "error", err)
+			continue
+		}
+	}
+
+	return nil
+}
+
+// Part returns the number of the part the next note is added to, starting at 1
+func (w *nsxWriter) Part() int {
+	return len(w.done) + 1
+}
+
+// Close finishes the last part, moves every part into its final location and
+// returns the paths of the NSX files written
+func (w *nsxWriter) Close() ([]string, error) {
+	if w.current == nil && len(w.done) == 0 {
+		// Always produce an archive, even without notes
+		if err := w.startPart(); err != nil {
+			return nil, err
+		}
+	}
+	if w.current != nil {
+		if err := w.finishPart(); err != nil {
+			return nil, err
+		}
+	}
+
+	if w.toStream() {
+		w.done = nil
+		return []string{}, nil
+	}
+
+	outputPaths := partPaths(w.outputNSXPath, len(w.done))
+	if w.options.DryRun {
+		w.done = nil
+		return outputPaths, nil
+	}
+	if !w.options.Force {
+		for _, outputPath := range outputPaths {
+			if _, err := os.Stat(outputPath); err == nil {
+				return nil, fmt.Errorf("%w: %s", ErrOutputExists, outputPath)
+			}
+		}
+	}
+	for i, tempPath := range w.done {
+		if err := os.Rename(tempPath, outputPaths[i]); err != nil {
+			return nil, fmt.Errorf("failed to move NSX file into place: %w", err)
+		}
+	}
+	w.done = nil
+
+	return outputPaths, nil
+}
+
+// Abort discards everything written so far. It is safe to call after Close.
+func (w *nsxWriter) Abort() {
+	if w.current != nil {
+		_ = w.current.zipWriter.Close()
+		if w.current.file != nil {
+			_ = w.current.file.Close()
+			w.done = append(w.done, w.current.file.Name())
+		}
+		w.current = nil
+	}
+	if w.toStream() || w.options.DryRun {
+		w.done = nil
+		return
+	}
+	for _, tempPath := range w.done {
+		if err := os.Remove(tempPath); err != nil && !os.IsNotExist(err) {
+			w.logger.Warn("Could not remove temporary file", "path", tempPath, "error", err)
+		}
+	}
+	w.done = nil
+}
+
+// toStream reports whether the archive is written to a stream
+func (w *nsxWriter) toStream() bool {
+	return w.stream != nil
+}
+
+// name describes where the archive is written, for logging
+func (w *nsxWriter) name() string {
+	if w.toStream() {
+		return "stream"
+	}
+	return w.outputNSXPath
+}
+
+// startPart opens a new temporary archive for the next part
+func (w *nsxWriter) startPart() error {
+	if w.toStream() || w.options.DryRun {
+		output := w.stream
+		if w.options.DryRun {
+			output = io.Discard
+		}
+		w.current = &nsxPartWriter{
+			zipWriter: zip.NewWriter(&countingWriter{w: output, progress: w.progress}),
+			noteIDs:   make([]string, 0),
+			files:     make(map[string]bool),
+		}
+		return nil
+	}
+
+	dir := filepath.Dir(w.outputNSXPath)
+	pattern := "." + strings.TrimSuffix(filepath.Base(w.outputNSXPath), ".nsx") + "-*.nsx.tmp"
+
+	file, err := createTemp(dir, pattern)
+	if err != nil {
+		return fmt.Errorf("failed to create NSX file: %w", err)
+	}
+
+	w.current = &nsxPartWriter{
+		file:      file,
+		zipWriter: zip.NewWriter(&countingWriter{w: file, progress: w.progress}),
+		noteIDs:   make([]string, 0),
+		files:     make(map[string]bool),
+	}
+	return nil
+}
+
+// finishPart writes the notebook and config entries of the current part and
+// closes its archive
+func (w *nsxWriter) finishPart() error {
+	part := w.current
+	w.current = nil
+	if part.file != nil {
+		w.done = append(w.done, part.file.Name())
+	} else {
+		w.done = append(w.done, "-")
+	}
+
+	if len(w.done) > 1 || w.options.MaxNotesPerFile > 0 || w.options.MaxBytesPerFile > 0 {
+		w.logger.Info("Finished part", "part", len(w.done), "notes", len(part.noteIDs), "bytes", part.size)
+	}
+
+	if err := w.writeIndex(part); err != nil {
+		_ = part.zipWriter.Close()
+		part.closeFile()
+		return err
+	}
+
+	if err := part.zipWriter.Close(); err != nil {
+		part.closeFile()
+		return fmt.Errorf("failed to close zip writer: %w", err)
+	}
+	if part.file == nil {
+		return nil
+	}
+	if err := part.file.Close(); err != nil {
+		return fmt.Errorf("failed to close NSX file: %w", err)
+	}
+	return nil
+}
+
+// closeFile closes the part's temporary file, if it has one
+func (p *nsxPartWriter) closeFile() {
+	if p.file != nil {
+		_ = p.file.Close()
+	}
+}
+
+// writeIndex adds the notebook and config.json entries to a part
+func (w *nsxWriter) writeIndex(part *nsxPartWriter) error {
+	// Add notebook
+	notebook := Notebook{
+		Category: "notebook",
+		ParentID: "",
+		Title:    w.notebookName,
+	}
+
+	notebookData, err := json.Marshal(notebook)
+	if err != nil {
+		return fmt.Errorf("failed to marshal notebook: %w", err)
+	}
+
+	writer, err := w.createEntry(part, w.notebookID)
+	if err != nil {
+		return fmt.Errorf("failed to create notebook entry: %w", err)
+	}
+
+	if _, err := writer.Write(notebookData); err != nil {
+		return fmt.Errorf("failed to write notebook: %w", err)
+	}
+
+	// Add config
+	config := NotebookConfig{
+		Note:     part.noteIDs,
+		Notebook: []string{w.notebookID},
+	}
+
+	configData, err := json.Marshal(config)
+	if err != nil {
+		return fmt.Errorf("failed to marshal config: %w", err)
+	}
+
+	writer, err = w.createEntry(part, "config.json")
+	if err != nil {
+		return fmt.Errorf("failed to create config entry: %w", err)
+	}
+
+	if _, err := writer.Write(configData); err != nil {
+		return fmt.Errorf("failed to write config: %w", err)
+	}
+
+	return nil
+}
+
+// copyFile streams an attachment from the source file system into the archive
+func (w *nsxWriter) copyFile(ctx context.Context, part *nsxPartWriter, file storedFile) error {
+	if w.options.DryRun {
+		return nil
+	}
+
+	source, err := w.source.Open(file.Path)
+	if err != nil {
+		return err
+	}
+	defer source.Close()
+
+	fileKey := "file_" + file.MD5Hash
+	writer, err := w.createEntry(part, fileKey)
+	if err != nil {
+		return fmt.Errorf("failed to create zip entry %s: %w", fileKey, err)
+	}
+
+	if _, err := io.Copy(writer, &contextReader{ctx: ctx, r: source}); err != nil {
+		return err
+	}
+
+	w.logger.Debug("Wrote image", "key", fileKey)
+	return nil
+}
+
+// createEntry adds a file to the archive with a fixed modification time, so
+// identical input produces byte-identical archives
+func (w *nsxWriter) createEntry(part *nsxPartWriter, name string) (io.Writer, error) {
+	return part.zipWriter.CreateHeader(&zip.FileHeader{
+		Name:     name,
+		Method:   zip.Deflate,
+		Modified: w.modified,
+	})
+}
+
+// noteCost returns how many uncompressed bytes adding the note would add to part
+func (w *nsxWriter) noteCost(part *nsxPartWriter, noteData []byte, files []storedFile) int64 {
+	size := int64(len(noteData))
+	seen := make(map[string]bool)
+	for _, file := range files {
+		if !part.files[file.MD5Hash] && !seen[file.MD5Hash] {
+			seen[file.MD5Hash] = true
+			size += file.Size
+		}
+	}
+	return size
+}
+
+// exceedsLimits reports whether adding a note of the given size to part would
+// break the configured split limits
+func (w *nsxWriter) exceedsLimits(part *nsxPartWriter, noteCost int64) bool {
+	if w.options.MaxNotesPerFile > 0 && len(part.noteIDs) >= w.options.MaxNotesPerFile {
+		return true
+	}
+	if w.options.MaxBytesPerFile > 0 && part.size+noteCost > w.options.MaxBytesPerFile {
+		return true
+	}
+	return false
+}
+
+// partPaths returns the output file names for a split archive. A single part
+// keeps the original name; multiple parts are numbered "name-1.nsx", "name-2.nsx", ...
+func partPaths(outputNSXPath string, count int) []string {
+	if count <= 1 {
+		return []string{outputNSXPath}
+	}
+
+	base := strings.TrimSuffix(outputNSXPath, ".nsx")
+	paths := make([]string, count)
+	for i := range paths {
+		paths[i] = fmt.Sprintf("%s-%d.nsx", base, i+1)
+	}
+	return paths
+}
+
+// createTemp creates a new temporary file like os.CreateTemp, but readable by
+// everyone (subject to the umask) like a file created with os.Create, so the
+// finished NSX file keeps the usual permissions once it is moved into place
+func createTemp(dir, pattern string) (*os.File, error) {
+	prefix, suffix, _ := strings.Cut(pattern, "*")
+	for range 10000 {
+		name := filepath.Join(dir, prefix+strconv.FormatUint(uint64(rand.Uint32()), 10)+suffix)
+		file, err := os.OpenFile(name, os.O_RDWR|os.O_CREATE|os.O_EXCL, 0o644)
+		if errors.Is(err, fs.ErrExist) {
+			continue
+		}
+		return file, err
+	}
+	return nil, fmt.Errorf("failed to find an unused temporary file name in %s", dir)
+}
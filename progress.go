@@ -0,0 +1,181 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/clark-ioe/md2nsx/nsx"
+)
+
+const (
+	// redrawInterval limits how often the status line is redrawn on a terminal
+	redrawInterval = 100 * time.Millisecond
+	// reportInterval is the time between plain progress lines when stderr is
+	// not a terminal
+	reportInterval = 5 * time.Second
+	// barWidth is the number of characters of the progress bar
+	barWidth = 24
+)
+
+// status is the status line at the bottom of the terminal, or nil when logs
+// do not go to a terminal
+var status *statusLine
+
+// statusLine wraps a terminal and keeps a single status line below
+// everything written through it. Log lines are printed above the status line,
+// which is then redrawn.
+type statusLine struct {
+	mu   sync.Mutex
+	out  io.Writer
+	text string
+}
+
+// Write prints p above the status line
+func (s *statusLine) Write(p []byte) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.text != "" {
+		fmt.Fprint(s.out, "\r\033[K")
+	}
+	n, err := s.out.Write(p)
+	if s.text != "" {
+		fmt.Fprint(s.out, s.text)
+	}
+	return n, err
+}
+
+// Set replaces the status line
+func (s *statusLine) Set(text string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.text = text
+	fmt.Fprint(s.out, "\r\033[K"+text)
+}
+
+// Clear removes the status line
+func (s *statusLine) Clear() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.text != "" {
+		fmt.Fprint(s.out, "\r\033[K")
+		s.text = ""
+	}
+}
+
+// isTerminal reports whether w is a terminal
+func isTerminal(w io.Writer) bool {
+	file, ok := w.(*os.File)
+	if !ok {
+		return false
+	}
+	info, err := file.Stat()
+	return err == nil && info.Mode()&os.ModeCharDevice != 0
+}
+
+// progressDisplay shows the progress of a conversion run: on a terminal as a
+// redrawn progress bar with an ETA, otherwise as a plain log line every few
+// seconds. A nil display ignores every update.
+type progressDisplay struct {
+	mu     sync.Mutex
+	status *statusLine
+	last   time.Time
+}
+
+// newProgressDisplay creates a display. It returns nil when informational
+// messages are not logged, such as with --quiet.
+func newProgressDisplay() *progressDisplay {
+	if !logger.Enabled(context.Background(), slog.LevelInfo) {
+		return nil
+	}
+	return &progressDisplay{
+		status: status,
+		last:   time.Now(),
+	}
+}
+
+// Update shows the state if enough time has passed since the last update.
+// The state of the last file is always drawn on a terminal.
+func (d *progressDisplay) Update(state nsx.Progress) {
+	if d == nil {
+		return
+	}
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	now := time.Now()
+	interval := reportInterval
+	if d.status != nil {
+		interval = redrawInterval
+	}
+	last := state.Files == state.Total
+	if now.Sub(d.last) < interval && !(last && d.status != nil) {
+		return
+	}
+	d.last = now
+
+	if d.status != nil {
+		d.status.Set(progressBar(state))
+		return
+	}
+	if !last {
+		logger.Info("Progress",
+			"files", fmt.Sprintf("%d/%d", state.Files, state.Total),
+			"attachments", state.Attachments,
+			"written", formatBytes(state.Bytes),
+			"eta", eta(state))
+	}
+}
+
+// Finish removes the progress bar
+func (d *progressDisplay) Finish() {
+	if d == nil || d.status == nil {
+		return
+	}
+	d.status.Clear()
+}
+
+// progressBar renders the status line
+func progressBar(state nsx.Progress) string {
+	filled := barWidth
+	if state.Total > 0 {
+		filled = barWidth * state.Files / state.Total
+	}
+	return fmt.Sprintf("[%s%s] %d/%d files  %d attachments  %s written  ETA %s",
+		strings.Repeat("=", filled), strings.Repeat(" ", barWidth-filled),
+		state.Files, state.Total, state.Attachments, formatBytes(state.Bytes), eta(state))
+}
+
+// eta estimates the remaining time from the average time per file so far
+func eta(state nsx.Progress) string {
+	if state.Files == 0 {
+		return "unknown"
+	}
+	if state.Files >= state.Total {
+		return "0s"
+	}
+	perFile := state.Elapsed / time.Duration(state.Files)
+	return (perFile * time.Duration(state.Total-state.Files)).Round(time.Second).String()
+}
+
+// formatBytes formats a byte count for humans, e.g. "12.3 MB"
+func formatBytes(n int64) string {
+	const unit = 1024
+	if n < unit {
+		return fmt.Sprintf("%d B", n)
+	}
+	div, exp := int64(unit), 0
+	for value := n / unit; value >= unit; value /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f %cB", float64(n)/float64(div), "KMGTPE"[exp])
+}
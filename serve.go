@@ -0,0 +1,243 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"runtime"
+	"strconv"
+	"time"
+
+	"github.com/clark-ioe/md2nsx/nsx"
+	"github.com/spf13/cobra"
+)
+
+// uploadMemory is how much of an upload is kept in memory; the rest of the
+// multipart form is buffered in temporary files
+const uploadMemory = 32 << 20
+
+// newServeCommand builds "md2nsx serve"
+func newServeCommand() *cobra.Command {
+	server := &conversionServer{}
+	var listen, maxUpload, maxUnpacked string
+	var maxConcurrent int
+
+	cmd := &cobra.Command{
+		Use:   "serve [flags]",
+		Short: "Run an HTTP service that converts uploaded archives of markdown",
+		Long: `Run an HTTP service that converts uploaded archives of markdown.
+
+POST a multipart form to /convert with the archive in the "file" field
+(.zip, .tar.gz, .tgz or .tar). The NSX file is streamed back. Optional
+fields: notebook, tag (repeatable), theme, recursive and timestamp.
+GET /healthz reports whether the service is up.`,
+		Example: `  md2nsx serve --listen :8080 --max-upload 200MB
+  curl -F file=@docs.zip -F notebook=Docs -F recursive=true -o docs.nsx http://localhost:8080/convert`,
+		Args: cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			var err error
+			if server.maxUpload, err = parseSize(maxUpload); err != nil || server.maxUpload == 0 {
+				return fmt.Errorf("invalid --max-upload value '%s'", maxUpload)
+			}
+			if server.maxUnpacked, err = parseSize(maxUnpacked); err != nil || server.maxUnpacked == 0 {
+				return fmt.Errorf("invalid --max-unpacked value '%s'", maxUnpacked)
+			}
+			if maxConcurrent < 1 {
+				return fmt.Errorf("--max-concurrent must be at least 1")
+			}
+			if server.jobs < 1 {
+				return fmt.Errorf("--jobs must be at least 1")
+			}
+			server.slots = make(chan struct{}, maxConcurrent)
+			return server.run(cmd.Context(), listen)
+		},
+	}
+	cmd.Flags().StringVar(&listen, "listen", "127.0.0.1:8080", "address to listen on")
+	cmd.Flags().StringVar(&maxUpload, "max-upload", "100MB", "largest upload accepted")
+	cmd.Flags().StringVar(&maxUnpacked, "max-unpacked", "500MB", "largest total size of the files in an upload once unpacked")
+	cmd.Flags().IntVar(&maxConcurrent, "max-concurrent", 4, "conversions run at the same time; further requests are rejected with 503")
+	cmd.Flags().IntVarP(&server.jobs, "jobs", "j", runtime.NumCPU(), "number of files each conversion converts concurrently")
+	cmd.Flags().DurationVar(&server.timeout, "timeout", 5*time.Minute, "longest time a single conversion may take (0 = no limit)")
+
+	return cmd
+}
+
+// conversionServer converts uploaded archives over HTTP
+type conversionServer struct {
+	maxUpload   int64
+	maxUnpacked int64
+	timeout     time.Duration
+	jobs        int
+
+	// slots holds a token for every conversion in progress
+	slots chan struct{}
+}
+
+// run serves requests on addr until ctx is cancelled, then waits for the
+// conversions in progress to finish
+func (s *conversionServer) run(ctx context.Context, addr string) error {
+	mux := http.NewServeMux()
+	mux.HandleFunc("POST /convert", s.handleConvert)
+	mux.HandleFunc("GET /healthz", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintln(w, "ok")
+	})
+
+	listener, err := net.Listen("tcp", addr)
+	if err != nil {
+		return fmt.Errorf("failed to listen: %w", err)
+	}
+	server := &http.Server{
+		Handler:           mux,
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+
+	errs := make(chan error, 1)
+	go func() {
+		errs <- server.Serve(listener)
+	}()
+	logger.Info("Listening", "addr", listener.Addr().String(), "max_upload", formatBytes(s.maxUpload), "max_unpacked", formatBytes(s.maxUnpacked), "max_concurrent", cap(s.slots))
+
+	select {
+	case err := <-errs:
+		return err
+	case <-ctx.Done():
+	}
+
+	logger.Info("Shutting down, waiting for conversions in progress")
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	return server.Shutdown(shutdownCtx)
+}
+
+// handleConvert converts the uploaded archive and streams back the NSX file
+func (s *conversionServer) handleConvert(w http.ResponseWriter, r *http.Request) {
+	select {
+	case s.slots <- struct{}{}:
+		defer func() { <-s.slots }()
+	default:
+		w.Header().Set("Retry-After", "5")
+		http.Error(w, "too many conversions in progress, try again later", http.StatusServiceUnavailable)
+		return
+	}
+
+	r.Body = http.MaxBytesReader(w, r.Body, s.maxUpload)
+	if err := r.ParseMultipartForm(uploadMemory); err != nil {
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			http.Error(w, fmt.Sprintf("upload larger than %s", formatBytes(s.maxUpload)), http.StatusRequestEntityTooLarge)
+			return
+		}
+		http.Error(w, fmt.Sprintf("invalid multipart upload: %v", err), http.StatusBadRequest)
+		return
+	}
+	defer r.MultipartForm.RemoveAll()
+
+	file, header, err := r.FormFile("file")
+	if err != nil {
+		http.Error(w, `missing "file" field with the archive`, http.StatusBadRequest)
+		return
+	}
+	defer file.Close()
+
+	archive, err := nsx.NewArchive(file, header.Size, header.Filename, s.maxUnpacked)
+	if errors.Is(err, nsx.ErrArchiveTooLarge) {
+		http.Error(w, fmt.Sprintf("upload unpacks to more than %s", formatBytes(s.maxUnpacked)), http.StatusRequestEntityTooLarge)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	options, err := s.options(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	options.FS = archive
+	options.Logger = logger.With("remote", r.RemoteAddr, "upload", header.Filename)
+
+	ctx := r.Context()
+	if s.timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, s.timeout)
+		defer cancel()
+	}
+
+	start := time.Now()
+	out := &responseStream{w: w, filename: safeFilename(options.Notebook) + ".nsx"}
+	report, err := nsx.NewConverter(options).Convert(ctx, []string{archive.Root()}, out)
+	if err != nil {
+		options.Logger.Error("Conversion failed", "error", err)
+		if out.started {
+			// The status was sent with the first byte, so all that is left
+			// is to cut the response short rather than end it cleanly
+			panic(http.ErrAbortHandler)
+		}
+		switch {
+		case errors.Is(err, nsx.ErrNoMarkdownFiles):
+			http.Error(w, err.Error(), http.StatusUnprocessableEntity)
+		case errors.Is(err, context.DeadlineExceeded):
+			http.Error(w, "conversion timed out", http.StatusServiceUnavailable)
+		default:
+			http.Error(w, fmt.Sprintf("conversion failed: %v", err), http.StatusInternalServerError)
+		}
+		return
+	}
+
+	options.Logger.Info("Converted upload",
+		"files", report.Count(nsx.StatusConverted),
+		"failed", report.Count(nsx.StatusFailed),
+		"bytes", out.written,
+		"duration", time.Since(start).Round(time.Millisecond))
+}
+
+// options turns the form fields of a request into converter options, using
+// the same validation as the command line
+func (s *conversionServer) options(r *http.Request) (nsx.Options, error) {
+	flags := &convertFlags{
+		notebookName: nsx.DefaultNotebook,
+		theme:        "github",
+		workers:      s.jobs,
+		tags:         r.MultipartForm.Value["tag"],
+		timestamp:    r.FormValue("timestamp"),
+	}
+	if notebook := r.FormValue("notebook"); notebook != "" {
+		flags.notebookName = notebook
+	}
+	if theme := r.FormValue("theme"); theme != "" {
+		flags.theme = theme
+	}
+	if recursive := r.FormValue("recursive"); recursive != "" {
+		value, err := strconv.ParseBool(recursive)
+		if err != nil {
+			return nsx.Options{}, fmt.Errorf("invalid recursive value '%s'", recursive)
+		}
+		flags.recursive = value
+	}
+	return flags.options()
+}
+
+// responseStream sends the response headers together with the first bytes of
+// the archive, so errors found before anything was written can still be
+// answered with an error status
+type responseStream struct {
+	w        http.ResponseWriter
+	filename string
+	started  bool
+	written  int64
+}
+
+// Write writes archive data to the response
+func (s *responseStream) Write(p []byte) (int, error) {
+	if !s.started {
+		s.started = true
+		s.w.Header().Set("Content-Type", "application/octet-stream")
+		s.w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", s.filename))
+		s.w.WriteHeader(http.StatusOK)
+	}
+	n, err := s.w.Write(p)
+	s.written += int64(n)
+	return n, err
+}
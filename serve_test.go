@@ -0,0 +1,93 @@
+package main
+
+import (
+	"archive/zip"
+	"bytes"
+	"io"
+	"log/slog"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+// uploadRequest builds a /convert request uploading an archive named name
+func uploadRequest(t *testing.T, name string, archive []byte) *http.Request {
+	t.Helper()
+	var body bytes.Buffer
+	form := multipart.NewWriter(&body)
+	if err := form.WriteField("timestamp", "1"); err != nil {
+		t.Fatal(err)
+	}
+	file, err := form.CreateFormFile("file", name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := file.Write(archive); err != nil {
+		t.Fatal(err)
+	}
+	if err := form.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	req := httptest.NewRequest(http.MethodPost, "/convert", &body)
+	req.Header.Set("Content-Type", form.FormDataContentType())
+	return req
+}
+
+// zipFile packs files into a zip file using the given compression method
+func zipFile(t *testing.T, method uint16, files map[string][]byte) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	writer := zip.NewWriter(&buf)
+	for name, data := range files {
+		file, err := writer.CreateHeader(&zip.FileHeader{Name: name, Method: method})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := file.Write(data); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := writer.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func TestHandleConvertLimits(t *testing.T) {
+	logger = slog.New(slog.NewTextHandler(io.Discard, nil))
+
+	server := &conversionServer{
+		maxUpload:   64 << 10,
+		maxUnpacked: 1 << 20,
+		timeout:     time.Minute,
+		jobs:        1,
+		slots:       make(chan struct{}, 1),
+	}
+	tests := []struct {
+		name    string
+		archive []byte
+		status  int
+	}{
+		{"small archive", zipFile(t, zip.Deflate, map[string][]byte{"docs/a.md": []byte("# A\n")}), http.StatusOK},
+		{"compressed bomb", zipFile(t, zip.Deflate, map[string][]byte{"docs/a.md": []byte("# A\n"), "docs/zeros.bin": make([]byte, 4<<20)}), http.StatusRequestEntityTooLarge},
+		{"large upload", zipFile(t, zip.Store, map[string][]byte{"docs/a.md": bytes.Repeat([]byte("x"), 128<<10)}), http.StatusRequestEntityTooLarge},
+		{"no markdown", zipFile(t, zip.Deflate, map[string][]byte{"docs/a.txt": []byte("text")}), http.StatusUnprocessableEntity},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			recorder := httptest.NewRecorder()
+			server.handleConvert(recorder, uploadRequest(t, "docs.zip", test.archive))
+			if recorder.Code != test.status {
+				t.Errorf("status %d, want %d: %s", recorder.Code, test.status, recorder.Body.String())
+			}
+			if test.status == http.StatusOK {
+				if _, err := zip.NewReader(bytes.NewReader(recorder.Body.Bytes()), int64(recorder.Body.Len())); err != nil {
+					t.Errorf("response is not an NSX archive: %v", err)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,141 @@
+package main
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+
+	"github.com/clark-ioe/md2nsx/dsm"
+	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
+)
+
+// Environment variables holding the DSM connection settings. The password
+// and 2-step verification code have no flags, so they never show up in the
+// process list or shell history.
+const (
+	envDSMURL      = "MD2NSX_DSM_URL"
+	envDSMUser     = "MD2NSX_DSM_USER"
+	envDSMPassword = "MD2NSX_DSM_PASSWORD"
+	envDSMOTP      = "MD2NSX_DSM_OTP"
+)
+
+// dsmFlags holds the settings for uploading NSX files to a DSM
+type dsmFlags struct {
+	url      string
+	user     string
+	password string
+	otp      string
+	folder   string
+	insecure bool
+}
+
+// register adds the DSM flags to a command's flag set
+func (d *dsmFlags) register(flags *pflag.FlagSet) {
+	flags.StringVar(&d.url, "dsm-url", os.Getenv(envDSMURL), "DSM address, e.g. https://nas.local:5001 (default: $"+envDSMURL+")")
+	flags.StringVar(&d.user, "dsm-user", os.Getenv(envDSMUser), "DSM account (default: $"+envDSMUser+"); the password is read from $"+envDSMPassword)
+	flags.StringVar(&d.folder, "dsm-folder", "/home", "DSM folder the NSX files are uploaded to")
+	flags.BoolVar(&d.insecure, "dsm-insecure", false, "skip TLS certificate verification, for a DSM with a self-signed certificate")
+	d.password = os.Getenv(envDSMPassword)
+	d.otp = os.Getenv(envDSMOTP)
+}
+
+// check reports missing settings before any work is done
+func (d *dsmFlags) check() error {
+	switch {
+	case d.url == "":
+		return fmt.Errorf("uploading needs the DSM address (--dsm-url or $%s)", envDSMURL)
+	case d.user == "":
+		return fmt.Errorf("uploading needs a DSM account (--dsm-user or $%s)", envDSMUser)
+	case d.password == "":
+		return fmt.Errorf("uploading needs the DSM password ($%s or the config file)", envDSMPassword)
+	case !strings.HasPrefix(d.folder, "/"):
+		return fmt.Errorf("--dsm-folder must be an absolute DSM path such as /home, got '%s'", d.folder)
+	}
+	return nil
+}
+
+// uploadFiles uploads NSX files to the DSM. Synology does not document an
+// API for Note Station's import, so the files are imported from Note
+// Station's settings afterwards.
+func uploadFiles(ctx context.Context, d *dsmFlags, paths []string) error {
+	httpClient := http.DefaultClient
+	if d.insecure {
+		transport := http.DefaultTransport.(*http.Transport).Clone()
+		transport.TLSClientConfig = &tls.Config{InsecureSkipVerify: true}
+		httpClient = &http.Client{Transport: transport}
+	}
+
+	client := dsm.NewClient(d.url, httpClient)
+	if err := client.Login(ctx, d.user, d.password, d.otp); err != nil {
+		return fmt.Errorf("failed to log in to %s: %w", d.url, err)
+	}
+	defer func() {
+		if logoutErr := client.Logout(context.WithoutCancel(ctx)); logoutErr != nil {
+			logger.Warn("Could not log out of DSM", "error", logoutErr)
+		}
+	}()
+
+	for _, localPath := range paths {
+		remotePath, err := client.Upload(ctx, d.folder, localPath)
+		if err != nil {
+			return fmt.Errorf("failed to upload %s: %w", localPath, err)
+		}
+		logger.Info("Uploaded NSX file", "path", localPath, "remote", remotePath)
+	}
+	logger.Info("Import the uploaded files from Note Station's settings", "folder", d.folder)
+	return nil
+}
+
+// newUploadCommand builds "md2nsx upload"
+func newUploadCommand() *cobra.Command {
+	upload := &dsmFlags{}
+	var configPath string
+
+	cmd := &cobra.Command{
+		Use:   "upload [flags] <file.nsx>...",
+		Short: "Upload NSX files to a DSM for importing into Note Station",
+		Long: `Upload NSX files to a DSM for importing into Note Station.
+
+The files are uploaded with File Station to --dsm-folder. Synology does not
+document an API for Note Station's import, so import them from Note
+Station's settings afterwards.
+
+The DSM address and account come from --dsm-url and --dsm-user, the
+environment or the dsm section of the config file; the password only from
+$` + envDSMPassword + ` or the config file, and a 2-step verification code
+from $` + envDSMOTP + `.`,
+		Example: `  MD2NSX_DSM_PASSWORD=... md2nsx upload notes.nsx --dsm-url https://nas.local:5001 --dsm-user me`,
+		Args:    cobra.MinimumNArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			for _, path := range args {
+				if !isFile(path) {
+					return fmt.Errorf("'%s' is not a file", path)
+				}
+			}
+			configFile, err := findConfigFile(configPath, ".")
+			if err != nil {
+				return err
+			}
+			if configFile != "" {
+				config, err := loadConfigFile(configFile)
+				if err != nil {
+					return err
+				}
+				config.DSM.apply(upload, cmd.Flags())
+				logger.Info("Using config file", "path", configFile)
+			}
+			if err := upload.check(); err != nil {
+				return err
+			}
+			return uploadFiles(cmd.Context(), upload, args)
+		},
+	}
+	upload.register(cmd.Flags())
+	cmd.Flags().StringVar(&configPath, "config", "", "config file (default: md2nsx.yaml, md2nsx.yml or md2nsx.toml in the current directory)")
+
+	return cmd
+}
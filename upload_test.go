@@ -0,0 +1,65 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"log/slog"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/clark-ioe/md2nsx/dsm/dsmtest"
+)
+
+func TestUploadFiles(t *testing.T) {
+	logger = slog.New(slog.NewTextHandler(io.Discard, nil))
+
+	fake := dsmtest.NewServer("admin", "secret")
+	server := httptest.NewServer(fake)
+	defer server.Close()
+
+	dir := t.TempDir()
+	files := map[string][]byte{
+		"notes.nsx": []byte("notes"),
+		"work.nsx":  []byte("work"),
+	}
+	var paths []string
+	for name, data := range files {
+		path := filepath.Join(dir, name)
+		if err := os.WriteFile(path, data, 0644); err != nil {
+			t.Fatal(err)
+		}
+		paths = append(paths, path)
+	}
+	flags := dsmFlags{url: server.URL, user: "admin", password: "secret", folder: "/home/imports"}
+
+	if err := uploadFiles(context.Background(), &flags, paths); err != nil {
+		t.Fatalf("uploadFiles failed: %v", err)
+	}
+	for name, data := range files {
+		if uploaded, ok := fake.File("/home/imports/" + name); !ok || !bytes.Equal(uploaded, data) {
+			t.Errorf("%s was not uploaded to /home/imports", name)
+		}
+	}
+	if fake.Sessions() != 0 {
+		t.Errorf("%d sessions left after uploading, want 0", fake.Sessions())
+	}
+
+	// A failed upload still logs out
+	missing := append(paths, filepath.Join(dir, "missing.nsx"))
+	if err := uploadFiles(context.Background(), &flags, missing); err == nil || !strings.Contains(err.Error(), "failed to upload") {
+		t.Errorf("uploadFiles with a missing file returned %v, want an upload error", err)
+	}
+	if fake.Sessions() != 0 {
+		t.Errorf("%d sessions left after a failed upload, want 0", fake.Sessions())
+	}
+
+	wrong := flags
+	wrong.password = "wrong"
+	if err := uploadFiles(context.Background(), &wrong, paths); err == nil || !strings.Contains(err.Error(), "failed to log in") {
+		t.Errorf("uploadFiles with a wrong password returned %v, want a login error", err)
+	}
+}
@@ -0,0 +1,138 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/clark-ioe/md2nsx/nsx"
+	"github.com/fsnotify/fsnotify"
+)
+
+// watchFolder converts mdFolder once and then re-packages the NSX file
+// whenever a markdown file in the folder or a referenced attachment changes.
+// Changes are debounced so a burst of saves triggers a single rebuild, and
+// notes that did not change are reused from the converter's cache. The
+// report, if requested, is rewritten after every build. Each build is
+// limited by --timeout. It returns when ctx is cancelled, which also stops a
+// build in progress.
+func watchFolder(ctx context.Context, c *nsx.Converter, mdFolder string, flags *convertFlags, debounce time.Duration) error {
+	outputPath := flags.output
+	if outputPath == "" {
+		outputPath = defaultOutputPath(mdFolder)
+	}
+
+	// The report may be inside the watched folder, and writing it must not
+	// trigger another rebuild
+	reportPath := ""
+	if flags.reportPath != "" {
+		reportPath = absPath(flags.reportPath)
+	}
+
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		return fmt.Errorf("failed to start watcher: %w", err)
+	}
+	defer watcher.Close()
+
+	watched := make(map[string]bool)
+	rebuild := func() {
+		buildCtx, cancel := flags.context(ctx)
+		report, err := c.ConvertToFiles(buildCtx, []string{mdFolder}, outputPath)
+		cancel()
+		if reportErr := writeReport(flags, report); reportErr != nil {
+			logger.Warn("Could not write report", "error", reportErr)
+		}
+		if ctx.Err() != nil {
+			return
+		}
+		if err != nil {
+			logger.Error("Conversion failed", "error", conversionError(err))
+		} else {
+			// Later rebuilds replace the archive written by the first one
+			c.Options.Force = true
+		}
+
+		// Pick up subfolders with markdown files and directories of
+		// attachments referenced since the last build
+		for _, dir := range append([]string{mdFolder}, c.WatchDirs()...) {
+			dir = filepath.Clean(dir)
+			if watched[dir] {
+				continue
+			}
+			if err := watcher.Add(dir); err != nil {
+				logger.Warn("Could not watch folder", "dir", dir, "error", err)
+				continue
+			}
+			watched[dir] = true
+		}
+
+		logger.Info("Watching for changes, press Ctrl+C to stop", "folder", mdFolder)
+	}
+
+	rebuild()
+
+	timer := time.NewTimer(debounce)
+	timer.Stop()
+
+	for {
+		select {
+		case event, ok := <-watcher.Events:
+			if !ok {
+				return nil
+			}
+			if !isRelevantChange(event, reportPath) {
+				continue
+			}
+			timer.Reset(debounce)
+
+		case err, ok := <-watcher.Errors:
+			if !ok {
+				return nil
+			}
+			logger.Warn("Watch error", "error", err)
+
+		case <-timer.C:
+			logger.Info("Change detected, rebuilding")
+			rebuild()
+
+		case <-ctx.Done():
+			logger.Info("Stopped watching", "folder", mdFolder)
+			return nil
+		}
+	}
+}
+
+// isRelevantChange filters out events that must not trigger a rebuild, such
+// as the NSX files and the report at the absolute reportPath written by the
+// rebuild itself, and editor swap files
+func isRelevantChange(event fsnotify.Event, reportPath string) bool {
+	if event.Op == fsnotify.Chmod {
+		return false
+	}
+	if reportPath != "" && absPath(event.Name) == reportPath {
+		return false
+	}
+
+	name := filepath.Base(event.Name)
+	if strings.HasSuffix(name, ".nsx") || strings.HasSuffix(name, ".nsx.tmp") {
+		return false
+	}
+	if strings.HasPrefix(name, ".#") || strings.HasSuffix(name, "~") || strings.HasSuffix(name, ".swp") {
+		return false
+	}
+
+	return true
+}
+
+// absPath returns the absolute form of path, or the cleaned path if the
+// working directory is unknown
+func absPath(path string) string {
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return filepath.Clean(path)
+	}
+	return abs
+}
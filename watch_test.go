@@ -0,0 +1,38 @@
+package main
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/fsnotify/fsnotify"
+)
+
+func TestIsRelevantChange(t *testing.T) {
+	reportPath := absPath(filepath.Join("tree", "report.json"))
+	tests := []struct {
+		name string
+		op   fsnotify.Op
+		want bool
+	}{
+		{"tree/a.md", fsnotify.Write, true},
+		{"tree/images/logo.png", fsnotify.Create, true},
+		{"tree/a.md", fsnotify.Chmod, false},
+		{"tree.nsx", fsnotify.Write, false},
+		{"tree/.tree-123.nsx.tmp", fsnotify.Create, false},
+		{"tree/report.json", fsnotify.Write, false},
+		{"./tree/report.json", fsnotify.Create, false},
+		{"tree/sub/report.json", fsnotify.Write, true},
+		{"tree/.#a.md", fsnotify.Create, false},
+		{"tree/a.md~", fsnotify.Write, false},
+		{"tree/.a.md.swp", fsnotify.Write, false},
+	}
+	for _, test := range tests {
+		event := fsnotify.Event{Name: filepath.FromSlash(test.name), Op: test.op}
+		if got := isRelevantChange(event, reportPath); got != test.want {
+			t.Errorf("isRelevantChange(%s %s) = %v, want %v", test.op, test.name, got, test.want)
+		}
+	}
+	if !isRelevantChange(fsnotify.Event{Name: "tree/report.json", Op: fsnotify.Write}, "") {
+		t.Errorf("report.json was ignored without --report")
+	}
+}